@@ -2,18 +2,58 @@ package database
 
 import (
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"app/base/structures"
 )
 
 // database cleaning method
 func DelteAllHosts() error {
-	err := Db.Delete(structures.HostDAO{}).Error
+	err := Db.Delete(structures.SystemAdvisoriesDAO{}).Error
+	if err != nil {
+		return err
+	}
+	err = Db.Delete(structures.SystemPackageDAO{}).Error
+	if err != nil {
+		return err
+	}
+	err = Db.Delete(structures.HostDAO{}).Error
 	return err
 }
 
+// delete system and its packages and advisories, return number of deleted systems
+// SQLite doesn't enforce cascade delete
+func DeleteSystem(tx *gorm.DB, inventoryID string) (int64, error) {
+	systemIDs := tx.Model(structures.HostDAO{}).Select("id").Where("inventory_id = ?", inventoryID).QueryExpr()
+	err := tx.Where("system_id IN (?)", systemIDs).Delete(structures.SystemAdvisoriesDAO{}).Error
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Where("system_id IN (?)", systemIDs).Delete(structures.SystemPackageDAO{}).Error
+	if err != nil {
+		return 0, err
+	}
+	res := tx.Where("inventory_id = ?", inventoryID).Delete(structures.HostDAO{})
+	return res.RowsAffected, res.Error
+}
+
 func HostsCount() (int, error) {
 	cnt := 0
 	err := Db.Model(structures.HostDAO{}).Count(&cnt).Error
 	return cnt, err
 }
+
+// run function inside transaction, commit on success, rollback on error
+func Transaction(fn func(tx *gorm.DB) error) error {
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	err := fn(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// PostgreSQL error codes which go away by retrying, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+var transientPgCodes = map[pq.ErrorCode]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// connection, timeout and lock errors, the same statement may succeed later
+// all other errors are caused by written data and won't go away by retrying
+func IsTransient(err error) bool {
+	switch err {
+	case nil:
+		return false
+	case driver.ErrBadConn, sql.ErrConnDone, io.EOF, io.ErrUnexpectedEOF, context.DeadlineExceeded:
+		return true
+	}
+
+	switch e := err.(type) {
+	case net.Error:
+		return true
+	case *pq.Error:
+		// connection_exception and insufficient_resources classes
+		class := string(e.Code.Class())
+		return class == "08" || class == "53" || transientPgCodes[e.Code]
+	case sqlite3.Error:
+		return e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/bmizerany/assert"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestIsTransient(t *testing.T) {
+	assert.Equal(t, false, IsTransient(nil))
+	assert.Equal(t, true, IsTransient(driver.ErrBadConn))
+	assert.Equal(t, true, IsTransient(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.Equal(t, true, IsTransient(&pq.Error{Code: "08006"}))
+	assert.Equal(t, true, IsTransient(&pq.Error{Code: "40P01"}))
+	assert.Equal(t, false, IsTransient(&pq.Error{Code: "23505"}))
+	assert.Equal(t, true, IsTransient(sqlite3.Error{Code: sqlite3.ErrBusy}))
+	assert.Equal(t, false, IsTransient(sqlite3.Error{Code: sqlite3.ErrConstraint}))
+	assert.Equal(t, false, IsTransient(errors.New("rejected")))
+}
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"app/base/database/migrations"
+	"app/base/utils"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strconv"
+	"time"
+)
+
+// arbitrary key of PostgreSQL advisory lock held while migrating
+const migrationLockID = 7460013
+
+// row of schema_migrations table, one for each applied migration
+type appliedMigration struct {
+	Version   int       `gorm:"primary_key;auto_increment:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (appliedMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migration with time it was applied, nil when pending
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// apply all pending migrations, return number of applied ones
+func MigrateUp() (int, error) {
+	return migrateUp(Db, migrations.All())
+}
+
+// revert last n applied migrations, return number of reverted ones
+func MigrateDown(n int) (int, error) {
+	return migrateDown(Db, migrations.All(), n)
+}
+
+// all known migrations and the applied ones not known by this version of application
+func MigrationStatus() ([]MigrationState, error) {
+	var res []MigrationState
+	err := withMigrationLock(Db, func(tx *gorm.DB) error {
+		applied, err := loadApplied(tx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations.All() {
+			state := MigrationState{Version: migration.Version, Name: migration.Name}
+			if item, ok := applied[migration.Version]; ok {
+				state.AppliedAt = &item.AppliedAt
+				delete(applied, migration.Version)
+			}
+			res = append(res, state)
+		}
+		for _, item := range applied {
+			appliedAt := item.AppliedAt
+			res = append(res, MigrationState{Version: item.Version, Name: item.Name, AppliedAt: &appliedAt})
+		}
+		return nil
+	})
+	return res, err
+}
+
+// whole migration runs in single transaction, so it's applied completely or not at all
+// PostgreSQL runs it under advisory lock, SQLite locks the database for writing transaction
+func withMigrationLock(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	if tx.Dialect().GetName() == migrations.Postgres {
+		err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error
+		if err != nil {
+			return err
+		}
+	}
+	err := tx.AutoMigrate(&appliedMigration{}).Error
+	if err != nil {
+		return err
+	}
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func loadApplied(tx *gorm.DB) (map[int]appliedMigration, error) {
+	var items []appliedMigration
+	err := tx.Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int]appliedMigration{}
+	for _, item := range items {
+		applied[item.Version] = item
+	}
+	return applied, nil
+}
+
+func migrateUp(db *gorm.DB, all []migrations.Migration) (int, error) {
+	count := 0
+	err := withMigrationLock(db, func(tx *gorm.DB) error {
+		applied, err := loadApplied(tx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range all {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			err = execMigration(tx, migration.Version, migration.Up)
+			if err != nil {
+				return err
+			}
+			err = tx.Create(&appliedMigration{Version: migration.Version, Name: migration.Name,
+				AppliedAt: time.Now()}).Error
+			if err != nil {
+				return err
+			}
+			utils.Log("version", migration.Version, "name", migration.Name).Info("migration applied")
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func migrateDown(db *gorm.DB, all []migrations.Migration, n int) (int, error) {
+	count := 0
+	err := withMigrationLock(db, func(tx *gorm.DB) error {
+		applied, err := loadApplied(tx)
+		if err != nil {
+			return err
+		}
+		for i := len(all) - 1; i >= 0 && count < n; i-- {
+			migration := all[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			err = execMigration(tx, migration.Version, migration.Down)
+			if err != nil {
+				return err
+			}
+			err = tx.Delete(&appliedMigration{Version: migration.Version}).Error
+			if err != nil {
+				return err
+			}
+			utils.Log("version", migration.Version, "name", migration.Name).Info("migration reverted")
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// run statements for dialect of the database
+func execMigration(tx *gorm.DB, version int, statements map[string][]string) error {
+	dialect := tx.Dialect().GetName()
+	smts, ok := statements[dialect]
+	if !ok {
+		return fmt.Errorf("migration %d doesn't support %s database", version, dialect)
+	}
+	for _, smt := range smts {
+		err := tx.Exec(smt).Error
+		if err != nil {
+			return fmt.Errorf("migration %d failed: %s", version, err.Error())
+		}
+	}
+	return nil
+}
+
+// admin command: "migrate up", "migrate down [n]" or "migrate status"
+func RunMigrate(args []string) {
+	if len(args) == 0 {
+		panic("Provide migrate command: up, down or status")
+	}
+
+	switch args[0] {
+	case "up":
+		count, err := MigrateUp()
+		if err != nil {
+			panic(err)
+		}
+		utils.Log("applied", count).Info("database migrated")
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			var err error
+			n, err = strconv.Atoi(args[1])
+			if err != nil {
+				panic(err)
+			}
+		}
+		count, err := MigrateDown(n)
+		if err != nil {
+			panic(err)
+		}
+		utils.Log("reverted", count).Info("database migrated")
+	case "status":
+		states, err := MigrationStatus()
+		if err != nil {
+			panic(err)
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d %-30s %s\n", state.Version, state.Name, applied)
+		}
+	default:
+		panic(fmt.Sprintf("Unknown migrate command '%s'", args[0]))
+	}
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"app/base/database/migrations"
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestMigrationsOrdered(t *testing.T) {
+	all := migrations.All()
+	for i, migration := range all {
+		assert.Equal(t, i+1, migration.Version)
+		assert.NotEqual(t, "", migration.Name)
+		for _, dialect := range []string{migrations.Postgres, migrations.SQLite} {
+			assert.NotEqual(t, 0, len(migration.Up[dialect]))
+			assert.NotEqual(t, 0, len(migration.Down[dialect]))
+		}
+	}
+}
+
+func TestMigrationStatus(t *testing.T) {
+	ConfigureSQLite()
+
+	states, err := MigrationStatus()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, len(migrations.All()), len(states))
+	for _, state := range states {
+		assert.Equal(t, true, state.AppliedAt != nil)
+	}
+
+	// everything applied already
+	count, err := MigrateUp()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestMigrateDownUp(t *testing.T) {
+	ConfigureSQLite()
+	all := migrations.All()
+
+	count, err := MigrateDown(1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, count)
+
+	states, err := MigrationStatus()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, states[len(all)-1].AppliedAt == nil)
+	assert.Equal(t, true, states[0].AppliedAt != nil)
+
+	count, err = MigrateUp()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, count)
+
+	// revert all
+	count, err = MigrateDown(len(all) + 1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, len(all), count)
+	assert.Equal(t, false, Db.HasTable("hosts"))
+}
+
+func TestMigrationFailure(t *testing.T) {
+	ConfigureSQLite()
+	failing := append(migrations.All(), migrations.Migration{Version: 1000, Name: "failing",
+		Up: map[string][]string{migrations.SQLite: {`CREATE TABLE broken_1 (id int)`, `NOT SQL`}}})
+
+	_, err := migrateUp(Db, failing)
+	assert.NotEqual(t, nil, err)
+	// rolled back completely
+	assert.Equal(t, false, Db.HasTable("broken_1"))
+
+	unsupported := append(migrations.All(), migrations.Migration{Version: 1001, Name: "unsupported",
+		Up: map[string][]string{migrations.Postgres: {`SELECT 1`}}})
+	_, err = migrateUp(Db, unsupported)
+	assert.Equal(t, "migration 1001 doesn't support sqlite3 database", err.Error())
+}
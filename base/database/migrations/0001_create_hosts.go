@@ -0,0 +1,78 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "create_hosts",
+		Up: map[string][]string{
+			// "if not exists" adopts databases created by former create_schema.sql
+			Postgres: {
+				`CREATE TABLE IF NOT EXISTS hosts
+				(
+					id                      serial primary key,
+					inventory_id            varchar unique,
+					request                 varchar                     not null,
+					checksum                varchar                     not null,
+					updated                 TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+					account                 varchar,
+					display_name            varchar,
+					tags                    varchar,
+					stale_timestamp         TIMESTAMP WITH TIME ZONE,
+					stale_warning_timestamp TIMESTAMP WITH TIME ZONE,
+					culled_timestamp        TIMESTAMP WITH TIME ZONE
+				)`,
+				`CREATE OR REPLACE FUNCTION set_last_updated()
+					RETURNS TRIGGER AS
+				$set_last_updated$
+				BEGIN
+					IF (TG_OP = 'UPDATE' OR TG_OP = 'INSERT') OR
+					   NEW.updated IS NULL THEN
+						NEW.updated := CURRENT_TIMESTAMP;
+					END IF;
+					RETURN NEW;
+				END;
+				$set_last_updated$
+					LANGUAGE 'plpgsql'`,
+				`DROP TRIGGER IF EXISTS hosts_last_updated ON hosts`,
+				`CREATE TRIGGER hosts_last_updated
+					BEFORE INSERT OR UPDATE
+					ON hosts
+					FOR EACH ROW
+				EXECUTE PROCEDURE set_last_updated()`,
+			},
+			// insert is covered by column default, recursive triggers are disabled by default
+			SQLite: {
+				`CREATE TABLE hosts
+				(
+					id                      integer primary key autoincrement,
+					inventory_id            varchar unique,
+					request                 varchar  not null,
+					checksum                varchar  not null,
+					updated                 datetime DEFAULT CURRENT_TIMESTAMP,
+					account                 varchar,
+					display_name            varchar,
+					tags                    varchar,
+					stale_timestamp         datetime,
+					stale_warning_timestamp datetime,
+					culled_timestamp        datetime
+				)`,
+				`CREATE TRIGGER hosts_last_updated
+					AFTER UPDATE
+					ON hosts
+					FOR EACH ROW
+				BEGIN
+					UPDATE hosts SET updated = CURRENT_TIMESTAMP WHERE id = NEW.id;
+				END`,
+			},
+		},
+		Down: map[string][]string{
+			Postgres: {
+				`DROP TABLE hosts`,
+				`DROP FUNCTION set_last_updated()`,
+			},
+			SQLite: {
+				`DROP TABLE hosts`,
+			},
+		},
+	})
+}
@@ -0,0 +1,70 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "create_packages",
+		Up: map[string][]string{
+			Postgres: {
+				`CREATE TABLE IF NOT EXISTS package_name
+				(
+					id   serial primary key,
+					name varchar not null unique
+				)`,
+				`CREATE TABLE IF NOT EXISTS package
+				(
+					id      serial primary key,
+					name_id int     not null references package_name (id),
+					epoch   int     not null,
+					version varchar not null,
+					release varchar not null,
+					arch    varchar not null,
+					unique (name_id, epoch, version, release, arch)
+				)`,
+				`CREATE TABLE IF NOT EXISTS system_package
+				(
+					system_id  int not null references hosts (id) on delete cascade,
+					package_id int not null references package (id),
+					primary key (system_id, package_id)
+				)`,
+				`CREATE INDEX IF NOT EXISTS system_package_package_id_idx ON system_package (package_id)`,
+			},
+			SQLite: {
+				`CREATE TABLE package_name
+				(
+					id   integer primary key autoincrement,
+					name varchar not null unique
+				)`,
+				`CREATE TABLE package
+				(
+					id      integer primary key autoincrement,
+					name_id int     not null references package_name (id),
+					epoch   int     not null,
+					version varchar not null,
+					release varchar not null,
+					arch    varchar not null,
+					unique (name_id, epoch, version, release, arch)
+				)`,
+				`CREATE TABLE system_package
+				(
+					system_id  int not null references hosts (id) on delete cascade,
+					package_id int not null references package (id),
+					primary key (system_id, package_id)
+				)`,
+				`CREATE INDEX system_package_package_id_idx ON system_package (package_id)`,
+			},
+		},
+		Down: map[string][]string{
+			Postgres: {
+				`DROP TABLE system_package`,
+				`DROP TABLE package`,
+				`DROP TABLE package_name`,
+			},
+			SQLite: {
+				`DROP TABLE system_package`,
+				`DROP TABLE package`,
+				`DROP TABLE package_name`,
+			},
+		},
+	})
+}
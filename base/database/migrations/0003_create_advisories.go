@@ -0,0 +1,82 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "create_advisories",
+		Up: map[string][]string{
+			Postgres: {
+				`CREATE TABLE advisory_metadata
+				(
+					id            serial primary key,
+					name          varchar                  not null unique,
+					advisory_type varchar                  not null,
+					severity      varchar,
+					synopsis      varchar                  not null,
+					description   text                     not null,
+					solution      text,
+					url           varchar,
+					issued        TIMESTAMP WITH TIME ZONE not null,
+					updated       TIMESTAMP WITH TIME ZONE not null
+				)`,
+				`CREATE INDEX advisory_metadata_updated_idx ON advisory_metadata (updated)`,
+				`CREATE TABLE advisory_package
+				(
+					advisory_id int not null references advisory_metadata (id) on delete cascade,
+					package_id  int not null references package (id),
+					primary key (advisory_id, package_id)
+				)`,
+				`CREATE INDEX advisory_package_package_id_idx ON advisory_package (package_id)`,
+				`CREATE TABLE advisory_cve
+				(
+					advisory_id int     not null references advisory_metadata (id) on delete cascade,
+					cve         varchar not null,
+					primary key (advisory_id, cve)
+				)`,
+				`CREATE INDEX advisory_cve_cve_idx ON advisory_cve (cve)`,
+			},
+			SQLite: {
+				`CREATE TABLE advisory_metadata
+				(
+					id            integer primary key autoincrement,
+					name          varchar  not null unique,
+					advisory_type varchar  not null,
+					severity      varchar,
+					synopsis      varchar  not null,
+					description   text     not null,
+					solution      text,
+					url           varchar,
+					issued        datetime not null,
+					updated       datetime not null
+				)`,
+				`CREATE INDEX advisory_metadata_updated_idx ON advisory_metadata (updated)`,
+				`CREATE TABLE advisory_package
+				(
+					advisory_id int not null references advisory_metadata (id) on delete cascade,
+					package_id  int not null references package (id),
+					primary key (advisory_id, package_id)
+				)`,
+				`CREATE INDEX advisory_package_package_id_idx ON advisory_package (package_id)`,
+				`CREATE TABLE advisory_cve
+				(
+					advisory_id int     not null references advisory_metadata (id) on delete cascade,
+					cve         varchar not null,
+					primary key (advisory_id, cve)
+				)`,
+				`CREATE INDEX advisory_cve_cve_idx ON advisory_cve (cve)`,
+			},
+		},
+		Down: map[string][]string{
+			Postgres: {
+				`DROP TABLE advisory_cve`,
+				`DROP TABLE advisory_package`,
+				`DROP TABLE advisory_metadata`,
+			},
+			SQLite: {
+				`DROP TABLE advisory_cve`,
+				`DROP TABLE advisory_package`,
+				`DROP TABLE advisory_metadata`,
+			},
+		},
+	})
+}
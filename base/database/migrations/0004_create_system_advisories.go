@@ -0,0 +1,101 @@
+package migrations
+
+// SQLite can't drop columns, tables are rebuilt by down migration
+var sqliteHostsRebuild = []string{
+	`CREATE TABLE hosts_old
+	(
+		id                      integer primary key autoincrement,
+		inventory_id            varchar unique,
+		request                 varchar  not null,
+		checksum                varchar  not null,
+		updated                 datetime DEFAULT CURRENT_TIMESTAMP,
+		account                 varchar,
+		display_name            varchar,
+		tags                    varchar,
+		stale_timestamp         datetime,
+		stale_warning_timestamp datetime,
+		culled_timestamp        datetime
+	)`,
+	`INSERT INTO hosts_old SELECT id, inventory_id, request, checksum, updated, account, display_name, tags,
+		stale_timestamp, stale_warning_timestamp, culled_timestamp FROM hosts`,
+	`DROP TABLE hosts`,
+	`ALTER TABLE hosts_old RENAME TO hosts`,
+	`CREATE TRIGGER hosts_last_updated
+		AFTER UPDATE
+		ON hosts
+		FOR EACH ROW
+	BEGIN
+		UPDATE hosts SET updated = CURRENT_TIMESTAMP WHERE id = NEW.id;
+	END`,
+}
+
+var sqliteSystemPackageRebuild = []string{
+	`CREATE TABLE system_package_old
+	(
+		system_id  int not null references hosts (id) on delete cascade,
+		package_id int not null references package (id),
+		primary key (system_id, package_id)
+	)`,
+	`INSERT INTO system_package_old SELECT system_id, package_id FROM system_package`,
+	`DROP TABLE system_package`,
+	`ALTER TABLE system_package_old RENAME TO system_package`,
+	`CREATE INDEX system_package_package_id_idx ON system_package (package_id)`,
+}
+
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "create_system_advisories",
+		Up: map[string][]string{
+			Postgres: {
+				`CREATE TABLE system_advisories
+				(
+					system_id      int                      not null references hosts (id) on delete cascade,
+					advisory_id    int                      not null references advisory_metadata (id) on delete cascade,
+					first_reported TIMESTAMP WITH TIME ZONE not null,
+					when_patched   TIMESTAMP WITH TIME ZONE,
+					primary key (system_id, advisory_id)
+				)`,
+				`CREATE INDEX system_advisories_advisory_id_idx ON system_advisories (advisory_id)`,
+				`ALTER TABLE hosts
+					ADD COLUMN advisory_count_cache     int not null default 0,
+					ADD COLUMN advisory_enh_count_cache int not null default 0,
+					ADD COLUMN advisory_bug_count_cache int not null default 0,
+					ADD COLUMN advisory_sec_count_cache int not null default 0,
+					ADD COLUMN last_evaluation          TIMESTAMP WITH TIME ZONE`,
+				`ALTER TABLE system_package ADD COLUMN latest_evra varchar`,
+			},
+			SQLite: {
+				`CREATE TABLE system_advisories
+				(
+					system_id      int      not null references hosts (id) on delete cascade,
+					advisory_id    int      not null references advisory_metadata (id) on delete cascade,
+					first_reported datetime not null,
+					when_patched   datetime,
+					primary key (system_id, advisory_id)
+				)`,
+				`CREATE INDEX system_advisories_advisory_id_idx ON system_advisories (advisory_id)`,
+				`ALTER TABLE hosts ADD COLUMN advisory_count_cache int not null default 0`,
+				`ALTER TABLE hosts ADD COLUMN advisory_enh_count_cache int not null default 0`,
+				`ALTER TABLE hosts ADD COLUMN advisory_bug_count_cache int not null default 0`,
+				`ALTER TABLE hosts ADD COLUMN advisory_sec_count_cache int not null default 0`,
+				`ALTER TABLE hosts ADD COLUMN last_evaluation datetime`,
+				`ALTER TABLE system_package ADD COLUMN latest_evra varchar`,
+			},
+		},
+		Down: map[string][]string{
+			Postgres: {
+				`ALTER TABLE system_package DROP COLUMN latest_evra`,
+				`ALTER TABLE hosts
+					DROP COLUMN advisory_count_cache,
+					DROP COLUMN advisory_enh_count_cache,
+					DROP COLUMN advisory_bug_count_cache,
+					DROP COLUMN advisory_sec_count_cache,
+					DROP COLUMN last_evaluation`,
+				`DROP TABLE system_advisories`,
+			},
+			SQLite: append(append(sqliteSystemPackageRebuild, sqliteHostsRebuild...),
+				`DROP TABLE system_advisories`),
+		},
+	})
+}
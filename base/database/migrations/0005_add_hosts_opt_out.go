@@ -0,0 +1,56 @@
+package migrations
+
+// trigger created by create_hosts migration, recreated with rebuilt hosts table
+// insert is covered by column default, recursive triggers are disabled by default
+const sqliteHostsTrigger = `CREATE TRIGGER hosts_last_updated
+	AFTER UPDATE
+	ON hosts
+	FOR EACH ROW
+BEGIN
+	UPDATE hosts SET updated = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END`
+
+// hosts after create_system_advisories migration
+const sqliteHostsV2 = `CREATE TABLE %s
+(
+	id                       integer primary key autoincrement,
+	inventory_id             varchar unique,
+	request                  varchar  not null,
+	checksum                 varchar  not null,
+	updated                  datetime DEFAULT CURRENT_TIMESTAMP,
+	account                  varchar,
+	display_name             varchar,
+	tags                     varchar,
+	stale_timestamp          datetime,
+	stale_warning_timestamp  datetime,
+	culled_timestamp         datetime,
+	advisory_count_cache     int not null default 0,
+	advisory_enh_count_cache int not null default 0,
+	advisory_bug_count_cache int not null default 0,
+	advisory_sec_count_cache int not null default 0,
+	last_evaluation          datetime
+)`
+
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "add_hosts_opt_out",
+		Up: map[string][]string{
+			Postgres: {
+				`ALTER TABLE hosts ADD COLUMN opt_out boolean not null default false`,
+			},
+			SQLite: {
+				`ALTER TABLE hosts ADD COLUMN opt_out boolean not null default false`,
+			},
+		},
+		Down: map[string][]string{
+			Postgres: {
+				`ALTER TABLE hosts DROP COLUMN opt_out`,
+			},
+			SQLite: sqliteRebuild("hosts", sqliteHostsV2, "id, inventory_id, request, checksum, updated, account, "+
+				"display_name, tags, stale_timestamp, stale_warning_timestamp, culled_timestamp, "+
+				"advisory_count_cache, advisory_enh_count_cache, advisory_bug_count_cache, advisory_sec_count_cache, "+
+				"last_evaluation", sqliteHostsTrigger),
+		},
+	})
+}
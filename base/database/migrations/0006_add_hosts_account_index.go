@@ -0,0 +1,17 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "add_hosts_account_index",
+		// api queries are scoped by account
+		Up: map[string][]string{
+			Postgres: {`CREATE INDEX hosts_account_idx ON hosts (account)`},
+			SQLite:   {`CREATE INDEX hosts_account_idx ON hosts (account)`},
+		},
+		Down: map[string][]string{
+			Postgres: {`DROP INDEX hosts_account_idx`},
+			SQLite:   {`DROP INDEX hosts_account_idx`},
+		},
+	})
+}
@@ -0,0 +1,54 @@
+package migrations
+
+// hosts after add_hosts_opt_out migration
+const sqliteHostsV3 = `CREATE TABLE %s
+(
+	id                       integer primary key autoincrement,
+	inventory_id             varchar unique,
+	request                  varchar  not null,
+	checksum                 varchar  not null,
+	updated                  datetime DEFAULT CURRENT_TIMESTAMP,
+	account                  varchar,
+	display_name             varchar,
+	tags                     varchar,
+	stale_timestamp          datetime,
+	stale_warning_timestamp  datetime,
+	culled_timestamp         datetime,
+	advisory_count_cache     int not null default 0,
+	advisory_enh_count_cache int not null default 0,
+	advisory_bug_count_cache int not null default 0,
+	advisory_sec_count_cache int not null default 0,
+	last_evaluation          datetime,
+	opt_out                  boolean not null default false
+)`
+
+// systems list is filtered by account and sorted by advisory counts
+var countIndexes = []string{
+	`CREATE INDEX hosts_account_sec_count_idx ON hosts (account, advisory_sec_count_cache)`,
+	`CREATE INDEX hosts_account_bug_count_idx ON hosts (account, advisory_bug_count_cache)`,
+	`CREATE INDEX hosts_account_enh_count_idx ON hosts (account, advisory_enh_count_cache)`,
+}
+
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "add_hosts_last_upload",
+		Up: map[string][]string{
+			Postgres: append([]string{`ALTER TABLE hosts ADD COLUMN last_upload TIMESTAMP WITH TIME ZONE`},
+				countIndexes...),
+			SQLite: append([]string{`ALTER TABLE hosts ADD COLUMN last_upload datetime`}, countIndexes...),
+		},
+		Down: map[string][]string{
+			Postgres: {
+				`DROP INDEX hosts_account_sec_count_idx`,
+				`DROP INDEX hosts_account_bug_count_idx`,
+				`DROP INDEX hosts_account_enh_count_idx`,
+				`ALTER TABLE hosts DROP COLUMN last_upload`,
+			},
+			SQLite: sqliteRebuild("hosts", sqliteHostsV3, "id, inventory_id, request, checksum, updated, account, "+
+				"display_name, tags, stale_timestamp, stale_warning_timestamp, culled_timestamp, "+
+				"advisory_count_cache, advisory_enh_count_cache, advisory_bug_count_cache, advisory_sec_count_cache, "+
+				"last_evaluation, opt_out", sqliteHostsTrigger, `CREATE INDEX hosts_account_idx ON hosts (account)`),
+		},
+	})
+}
@@ -0,0 +1,32 @@
+package migrations
+
+const (
+	advisoryReferenceTable = `CREATE TABLE advisory_reference
+	(
+		advisory_id int     not null references advisory_metadata (id) on delete cascade,
+		reference   varchar not null,
+		primary key (advisory_id, reference)
+	)`
+	advisoryReleaseVersionTable = `CREATE TABLE advisory_release_version
+	(
+		advisory_id     int     not null references advisory_metadata (id) on delete cascade,
+		release_version varchar not null,
+		primary key (advisory_id, release_version)
+	)`
+)
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "create_advisory_references",
+		// references (bugzilla ids etc.) and release versions of advisories shown by advisory detail
+		Up: map[string][]string{
+			Postgres: {advisoryReferenceTable, advisoryReleaseVersionTable},
+			SQLite:   {advisoryReferenceTable, advisoryReleaseVersionTable},
+		},
+		Down: map[string][]string{
+			Postgres: {`DROP TABLE advisory_release_version`, `DROP TABLE advisory_reference`},
+			SQLite:   {`DROP TABLE advisory_release_version`, `DROP TABLE advisory_reference`},
+		},
+	})
+}
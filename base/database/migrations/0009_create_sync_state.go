@@ -0,0 +1,25 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "create_sync_state",
+		// start time of the last complete sync, modified_since of the next one
+		Up: map[string][]string{
+			Postgres: {`CREATE TABLE sync_state
+			(
+				name      varchar primary key,
+				last_sync TIMESTAMP WITH TIME ZONE not null
+			)`},
+			SQLite: {`CREATE TABLE sync_state
+			(
+				name      varchar primary key,
+				last_sync datetime not null
+			)`},
+		},
+		Down: map[string][]string{
+			Postgres: {`DROP TABLE sync_state`},
+			SQLite:   {`DROP TABLE sync_state`},
+		},
+	})
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"fmt"
+	"sort"
+)
+
+// database dialects, as named by gorm
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite3"
+)
+
+// versioned schema change, applied by "migrate" command
+// statements are listed for each dialect, down statements revert the up ones
+type Migration struct {
+	Version int
+	Name    string
+	Up      map[string][]string
+	Down    map[string][]string
+}
+
+var registered []Migration
+
+// called from init() of each migration file
+func register(migration Migration) {
+	registered = append(registered, migration)
+}
+
+// all migrations ordered by version
+func All() []Migration {
+	res := make([]Migration, len(registered))
+	copy(res, registered)
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Version < res[j].Version
+	})
+	return res
+}
+
+// SQLite can't drop columns, table is recreated with given create statement (table name as %s)
+// and listed columns, statements recreating indexes and triggers follow
+func sqliteRebuild(table, create, columns string, after ...string) []string {
+	rebuilt := table + "_rebuilt"
+	smts := []string{
+		fmt.Sprintf(create, rebuilt),
+		fmt.Sprintf("INSERT INTO %s SELECT %s FROM %s", rebuilt, columns, table),
+		fmt.Sprintf("DROP TABLE %s", table),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", rebuilt, table),
+	}
+	return append(smts, after...)
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"app/base/structures"
+	"app/base/utils"
+	"fmt"
+	"github.com/jinzhu/gorm"
+)
+
+// SQLite allows at most 999 params in one query
+const ChunkSize = 400
+
+// call fn for consecutive [start, end) ranges of n items, at most ChunkSize long
+func InChunks(n int, fn func(start, end int) error) error {
+	for start := 0; start < n; start += ChunkSize {
+		end := start + ChunkSize
+		if end > n {
+			end = n
+		}
+		err := fn(start, end)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// identifies row in package table
+type packageKey struct {
+	NameID  int
+	Epoch   int
+	Version string
+	Release string
+	Arch    string
+}
+
+// rows created meanwhile by concurrent transactions are skipped, their ids are loaded afterwards
+// works with both PostgreSQL and SQLite (3.24+)
+const (
+	insertPackageNameSQL = `INSERT INTO package_name (name) VALUES (?) ON CONFLICT (name) DO NOTHING`
+	insertPackageSQL     = `INSERT INTO package (name_id, epoch, version, release, arch) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (name_id, epoch, version, release, arch) DO NOTHING`
+)
+
+// return ids of parsed packages, create the ones not stored yet, unparsable packages are skipped
+func GetOrCreatePackages(tx *gorm.DB, nevras []string) ([]int, error) {
+	parsed := make([]*utils.Nevra, 0, len(nevras))
+	names := make([]string, 0, len(nevras))
+	for _, pkg := range nevras {
+		nevra, err := utils.ParseNevra(pkg)
+		if err != nil {
+			utils.Log("nevra", pkg, "err", err.Error()).Warn("unable to parse package, skipping")
+			continue
+		}
+		parsed = append(parsed, nevra)
+		names = append(names, nevra.Name)
+	}
+
+	nameIDs, err := getOrCreatePackageNames(tx, names)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(nameIDs))
+	for _, id := range nameIDs {
+		ids = append(ids, id)
+	}
+	packages, err := loadPackages(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]packageKey, len(parsed))
+	var missing []packageKey
+	seen := map[packageKey]bool{}
+	for i, nevra := range parsed {
+		keys[i] = packageKey{nameIDs[nevra.Name], nevra.EVR().Epoch, nevra.Version, nevra.Release, nevra.Arch}
+		if _, ok := packages[keys[i]]; !ok && !seen[keys[i]] {
+			missing = append(missing, keys[i])
+			seen[keys[i]] = true
+		}
+	}
+	err = createPackages(tx, missing, packages)
+	if err != nil {
+		return nil, err
+	}
+
+	packageIDs := make([]int, len(keys))
+	for i, key := range keys {
+		packageIDs[i] = packages[key]
+	}
+	return packageIDs, nil
+}
+
+// load ids of stored packages with given name ids into the map
+func loadPackages(tx *gorm.DB, nameIDs []int) (map[packageKey]int, error) {
+	packages := map[packageKey]int{}
+	err := InChunks(len(nameIDs), func(start, end int) error {
+		var stored []structures.PackageDAO
+		err := tx.Where("name_id IN (?)", nameIDs[start:end]).Find(&stored).Error
+		for _, pkg := range stored {
+			packages[packageKey{pkg.NameID, pkg.Epoch, pkg.Version, pkg.Release, pkg.Arch}] = pkg.ID
+		}
+		return err
+	})
+	return packages, err
+}
+
+// insert packages not stored yet, then add ids of all of them to packages
+func createPackages(tx *gorm.DB, keys []packageKey, packages map[packageKey]int) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	var nameIDs []int
+	for _, key := range keys {
+		err := tx.Exec(insertPackageSQL, key.NameID, key.Epoch, key.Version, key.Release, key.Arch).Error
+		if err != nil {
+			return err
+		}
+		nameIDs = append(nameIDs, key.NameID)
+	}
+	created, err := loadPackages(tx, nameIDs)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		id, ok := created[key]
+		if !ok {
+			return fmt.Errorf("package %v not created", key)
+		}
+		packages[key] = id
+	}
+	return nil
+}
+
+// return name to id map of package names, create the ones not stored yet
+func getOrCreatePackageNames(tx *gorm.DB, names []string) (map[string]int, error) {
+	nameIDs, err := loadPackageNames(tx, names)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		if _, ok := nameIDs[name]; !ok && !seen[name] {
+			missing = append(missing, name)
+			seen[name] = true
+		}
+	}
+	err = createPackageNames(tx, missing, nameIDs)
+	if err != nil {
+		return nil, err
+	}
+	return nameIDs, nil
+}
+
+// insert package names not stored yet, then add ids of all of them to nameIDs
+func createPackageNames(tx *gorm.DB, names []string, nameIDs map[string]int) error {
+	if len(names) == 0 {
+		return nil
+	}
+	for _, name := range names {
+		err := tx.Exec(insertPackageNameSQL, name).Error
+		if err != nil {
+			return err
+		}
+	}
+	created, err := loadPackageNames(tx, names)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		id, ok := created[name]
+		if !ok {
+			return fmt.Errorf("package name %s not created", name)
+		}
+		nameIDs[name] = id
+	}
+	return nil
+}
+
+// name to id map of stored package names
+func loadPackageNames(tx *gorm.DB, names []string) (map[string]int, error) {
+	nameIDs := map[string]int{}
+	err := InChunks(len(names), func(start, end int) error {
+		var stored []structures.PackageNameDAO
+		err := tx.Where("name IN (?)", names[start:end]).Find(&stored).Error
+		for _, name := range stored {
+			nameIDs[name.Name] = name.ID
+		}
+		return err
+	})
+	return nameIDs, err
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"app/base/structures"
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestInChunks(t *testing.T) {
+	var chunks [][2]int
+	err := InChunks(2*ChunkSize+1, func(start, end int) error {
+		chunks = append(chunks, [2]int{start, end})
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, [][2]int{{0, ChunkSize}, {ChunkSize, 2 * ChunkSize}, {2 * ChunkSize, 2*ChunkSize + 1}}, chunks)
+}
+
+func TestGetOrCreatePackages(t *testing.T) {
+	ConfigureSQLite()
+	nevras := []string{"bash-4.2.46-34.el7.x86_64", "glibc-2.17-292.el7.i686", "glibc-2.17-292.el7.x86_64",
+		"bash-4.2.46-34.el7.x86_64", "not-a-nevra"}
+
+	ids, err := GetOrCreatePackages(Db, nevras)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(ids))
+	assert.Equal(t, ids[0], ids[3])
+	assert.NotEqual(t, ids[1], ids[2])
+
+	again, err := GetOrCreatePackages(Db, nevras)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ids, again)
+}
+
+// the other transaction creates the same new package after this one found it missing,
+// this one then inserts it too, SQLite doesn't allow the other commit while this one has read
+func TestGetOrCreatePackagesConcurrent(t *testing.T) {
+	ConfigureSQLite()
+	other := Db.Begin()
+	ids, err := GetOrCreatePackages(other, []string{"kernel-3.10.0-1062.el7.x86_64"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, other.Commit().Error)
+	var stored structures.PackageDAO
+	assert.Equal(t, nil, Db.First(&stored, ids[0]).Error)
+
+	tx := Db.Begin()
+	defer tx.RollbackUnlessCommitted()
+	nameIDs := map[string]int{}
+	assert.Equal(t, nil, createPackageNames(tx, []string{"kernel"}, nameIDs))
+	assert.Equal(t, stored.NameID, nameIDs["kernel"])
+	key := packageKey{stored.NameID, stored.Epoch, stored.Version, stored.Release, stored.Arch}
+	packages := map[packageKey]int{}
+	assert.Equal(t, nil, createPackages(tx, []packageKey{key}, packages))
+	assert.Equal(t, ids[0], packages[key])
+	assert.Equal(t, nil, tx.Commit().Error)
+}
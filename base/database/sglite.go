@@ -3,7 +3,7 @@ package database
 import (
 	"fmt"
 	"github.com/satori/go.uuid"
-	"app/base/structures"
+	"app/base/database/migrations"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
@@ -18,7 +18,11 @@ func ConfigureSQLite() {
 	}
 	check(db)
 
-	db.AutoMigrate(&structures.HostDAO{})
+	// same schema as PostgreSQL, created by migrations
+	_, err = migrateUp(db, migrations.All())
+	if err != nil {
+		panic(err)
+	}
 
 	Db = db
 }
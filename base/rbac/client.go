@@ -0,0 +1,107 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	accessPath = "/api/rbac/v1/access/"
+	// permissions are requested for this application only
+	application = "patch"
+	pageSize    = 1000
+)
+
+// page of caller permissions
+type AccessResponse struct {
+	Data  []Access    `json:"data"`
+	Links AccessLinks `json:"links"`
+}
+
+// permission in "application:resource:verb" form, resource definitions are not used yet
+type Access struct {
+	Permission          string        `json:"permission"`
+	ResourceDefinitions []interface{} `json:"resourceDefinitions"`
+}
+
+type AccessLinks struct {
+	Next *string `json:"next"`
+}
+
+// client of RBAC service, permissions are resolved for identity which is forwarded
+type Client struct {
+	address string
+	client  *http.Client
+}
+
+func NewClient(address string, timeout time.Duration) *Client {
+	return &Client{address: strings.TrimSuffix(address, "/"), client: &http.Client{Timeout: timeout}}
+}
+
+// all permissions of caller with given x-rh-identity header, all pages are loaded
+// next page links can be either absolute or relative to the service address,
+// links to other hosts are rejected, identity is never sent outside of the service
+func (c *Client) Permissions(ctx context.Context, identity string) ([]string, error) {
+	base, err := url.Parse(c.address)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"application": {application}, "limit": {fmt.Sprint(pageSize)}}
+	next := base.ResolveReference(&url.URL{Path: accessPath, RawQuery: query.Encode()})
+	permissions := []string{}
+	for next != nil {
+		page, err := c.access(ctx, identity, next.String())
+		if err != nil {
+			return nil, err
+		}
+		for _, access := range page.Data {
+			permissions = append(permissions, access.Permission)
+		}
+		next = nil
+		if page.Links.Next != nil && *page.Links.Next != "" {
+			ref, err := url.Parse(*page.Links.Next)
+			if err != nil {
+				return nil, err
+			}
+			next = base.ResolveReference(ref)
+			if next.Scheme != base.Scheme || next.Host != base.Host {
+				return nil, fmt.Errorf("next page link %s points outside of RBAC service", next.String())
+			}
+		}
+	}
+	return permissions, nil
+}
+
+// single page, url includes query
+func (c *Client) access(ctx context.Context, identity, pageURL string) (*AccessResponse, error) {
+	request, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("x-rh-identity", identity)
+
+	resp, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("access request failed, status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var res AccessResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
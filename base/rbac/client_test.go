@@ -0,0 +1,88 @@
+package rbac
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/bmizerany/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func identity(account string) string {
+	return base64.StdEncoding.EncodeToString([]byte(`{"identity": {"account_number": "` + account + `"}}`))
+}
+
+func TestPermissions(t *testing.T) {
+	server := NewFakeServer(map[string][]string{"0000001": {"patch:*:read", "patch:systems:write"}})
+	defer server.Close()
+	client := NewClient(server.URL, time.Second)
+
+	permissions, err := client.Permissions(context.Background(), identity("0000001"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"patch:*:read", "patch:systems:write"}, permissions)
+
+	permissions, err = client.Permissions(context.Background(), identity("0000002"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{}, permissions)
+}
+
+func TestPermissionsPaged(t *testing.T) {
+	var many []string
+	for i := 0; i < pageSize+5; i++ {
+		many = append(many, fmt.Sprintf("patch:resource%d:read", i))
+	}
+	server := NewFakeServer(map[string][]string{"0000001": many})
+	defer server.Close()
+
+	permissions, err := NewClient(server.URL, time.Second).Permissions(context.Background(), identity("0000001"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, many, permissions)
+	assert.Equal(t, 2, server.Requests())
+}
+
+func TestPermissionsAbsoluteNext(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, accessPath, r.URL.Path)
+		resp := AccessResponse{Data: []Access{{Permission: "patch:*:read"}}}
+		if r.URL.Query().Get("offset") == "" {
+			next := server.URL + accessPath + "?application=patch&offset=1"
+			resp.Links.Next = &next
+		}
+		assert.Equal(t, nil, json.NewEncoder(w).Encode(resp))
+	}))
+	defer server.Close()
+
+	permissions, err := NewClient(server.URL+"/", time.Second).Permissions(context.Background(), identity("0000001"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"patch:*:read", "patch:*:read"}, permissions)
+}
+
+func TestPermissionsForeignNext(t *testing.T) {
+	foreign := NewFakeServer(map[string][]string{"0000001": {"patch:*:*"}})
+	defer foreign.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next := foreign.URL + accessPath + "?application=patch&offset=1"
+		resp := AccessResponse{Data: []Access{{Permission: "patch:*:read"}}, Links: AccessLinks{Next: &next}}
+		assert.Equal(t, nil, json.NewEncoder(w).Encode(resp))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL, time.Second).Permissions(context.Background(), identity("0000001"))
+	assert.Equal(t, "next page link "+foreign.URL+accessPath+"?application=patch&offset=1 points outside of "+
+		"RBAC service", err.Error())
+	assert.Equal(t, 0, foreign.Requests())
+}
+
+func TestPermissionsUnavailable(t *testing.T) {
+	server := NewFakeServer(nil)
+	defer server.Close()
+	server.FailNext(1)
+
+	_, err := NewClient(server.URL, time.Second).Permissions(context.Background(), identity("0000001"))
+	assert.Equal(t, "access request failed, status 503: service unavailable", err.Error())
+}
@@ -0,0 +1,95 @@
+package rbac
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+)
+
+// in-process stand-in of RBAC service for tests and local development
+// permissions are given by account number of the forwarded identity
+type FakeServer struct {
+	*httptest.Server
+	permissions map[string][]string
+	lock        sync.Mutex
+	requests    int
+	// number of next requests answered with 503
+	failures int
+}
+
+func NewFakeServer(permissions map[string][]string) *FakeServer {
+	server := FakeServer{permissions: permissions}
+	mux := http.NewServeMux()
+	mux.HandleFunc(accessPath, server.handleAccess)
+	server.Server = httptest.NewServer(mux)
+	return &server
+}
+
+// number of received requests, including the failed ones
+func (s *FakeServer) Requests() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests
+}
+
+// answer next n requests with 503 Service Unavailable
+func (s *FakeServer) FailNext(n int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failures = n
+}
+
+func (s *FakeServer) handleAccess(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	s.requests++
+	fail := s.failures > 0
+	if fail {
+		s.failures--
+	}
+	s.lock.Unlock()
+	if fail {
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	var identity struct {
+		Identity struct {
+			AccountNumber string `json:"account_number"`
+		} `json:"identity"`
+	}
+	decoded, err := base64.StdEncoding.DecodeString(r.Header.Get("x-rh-identity"))
+	if err == nil {
+		err = json.Unmarshal(decoded, &identity)
+	}
+	if err != nil {
+		http.Error(w, "invalid identity", http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Query().Get("application") != application {
+		http.Error(w, "unknown application", http.StatusBadRequest)
+		return
+	}
+
+	// paged by limit and offset, like the real service
+	permissions := s.permissions[identity.Identity.AccountNumber]
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	resp := AccessResponse{Data: []Access{}}
+	for i := offset; i < len(permissions) && i < offset+limit; i++ {
+		resp.Data = append(resp.Data, Access{Permission: permissions[i], ResourceDefinitions: []interface{}{}})
+	}
+	if offset+limit < len(permissions) {
+		next := fmt.Sprintf("%s?application=%s&limit=%d&offset=%d", accessPath, application, limit, offset+limit)
+		resp.Links.Next = &next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
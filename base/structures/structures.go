@@ -5,13 +5,144 @@ import (
 )
 
 type HostDAO struct {
-	ID              int        `json:"id"       gorm:"not null;primary_key" binding:"required"`
-	Request         string     `json:"request"  gorm:"not null"             binding:"required"`
-	Checksum        string     `json:"checksum" gorm:"not null"             binding:"required"`
-	Updated         time.Time  `json:"updated"  gorm:"-"`
+	ID                    int        `json:"id"                      gorm:"not null;primary_key" binding:"required"`
+	InventoryID           string     `json:"inventory_id"            gorm:"unique"`
+	Request               string     `json:"request"                 gorm:"not null"             binding:"required"`
+	Checksum              string     `json:"checksum"                gorm:"not null"             binding:"required"`
+	Updated               time.Time  `json:"updated"                 gorm:"-"`
+	Account               string     `json:"account"`
+	DisplayName           string     `json:"display_name"`
+	Tags                  string     `json:"tags"`
+	StaleTimestamp        *time.Time `json:"stale_timestamp"`
+	StaleWarningTimestamp *time.Time `json:"stale_warning_timestamp"`
+	CulledTimestamp       *time.Time `json:"culled_timestamp"`
+	// applicable advisories, total and by type, kept by evaluator
+	AdvisoryCountCache    int        `json:"advisory_count_cache"`
+	AdvisoryEnhCountCache int        `json:"advisory_enh_count_cache"`
+	AdvisoryBugCountCache int        `json:"advisory_bug_count_cache"`
+	AdvisorySecCountCache int        `json:"advisory_sec_count_cache"`
+	LastEvaluation        *time.Time `json:"last_evaluation"`
+	// opted out systems are not evaluated
+	OptOut                bool       `json:"opt_out"`
+	LastUpload            *time.Time `json:"last_upload"`
 }
 
 // db table name, for gorm
 func (HostDAO) TableName() string {
 	return "hosts"
 }
+
+// deduplicated package names
+type PackageNameDAO struct {
+	ID   int    `json:"id"   gorm:"primary_key"`
+	Name string `json:"name" gorm:"not null;unique"`
+}
+
+func (PackageNameDAO) TableName() string {
+	return "package_name"
+}
+
+// package name with epoch, version, release and arch, unique across all systems
+type PackageDAO struct {
+	ID      int    `json:"id"      gorm:"primary_key"`
+	NameID  int    `json:"name_id" gorm:"not null;unique_index:package_evra"`
+	Epoch   int    `json:"epoch"   gorm:"not null;unique_index:package_evra"`
+	Version string `json:"version" gorm:"not null;unique_index:package_evra"`
+	Release string `json:"release" gorm:"not null;unique_index:package_evra"`
+	Arch    string `json:"arch"    gorm:"not null;unique_index:package_evra"`
+}
+
+func (PackageDAO) TableName() string {
+	return "package"
+}
+
+// package installed on system, latest evra is the newest update available, nil when up to date
+type SystemPackageDAO struct {
+	SystemID   int     `json:"system_id"   gorm:"primary_key;auto_increment:false"`
+	PackageID  int     `json:"package_id"  gorm:"primary_key;auto_increment:false;index"`
+	LatestEVRA *string `json:"latest_evra" gorm:"column:latest_evra"`
+}
+
+func (SystemPackageDAO) TableName() string {
+	return "system_package"
+}
+
+// advisory (erratum) imported from VMaaS, type is "enhancement", "bugfix" or "security"
+type AdvisoryMetadataDAO struct {
+	ID           int       `json:"id"            gorm:"primary_key"`
+	Name         string    `json:"name"          gorm:"not null;unique"`
+	AdvisoryType string    `json:"advisory_type" gorm:"not null"`
+	Severity     *string   `json:"severity"`
+	Synopsis     string    `json:"synopsis"      gorm:"not null"`
+	Description  string    `json:"description"   gorm:"not null"`
+	Solution     string    `json:"solution"`
+	URL          string    `json:"url"`
+	Issued       time.Time `json:"issued"        gorm:"not null"`
+	Updated      time.Time `json:"updated"       gorm:"not null"`
+}
+
+func (AdvisoryMetadataDAO) TableName() string {
+	return "advisory_metadata"
+}
+
+// package fixed by advisory
+type AdvisoryPackageDAO struct {
+	AdvisoryID int `json:"advisory_id" gorm:"primary_key;auto_increment:false"`
+	PackageID  int `json:"package_id"  gorm:"primary_key;auto_increment:false"`
+}
+
+func (AdvisoryPackageDAO) TableName() string {
+	return "advisory_package"
+}
+
+// CVE fixed by advisory
+type AdvisoryCveDAO struct {
+	AdvisoryID int    `json:"advisory_id" gorm:"primary_key;auto_increment:false"`
+	Cve        string `json:"cve"         gorm:"primary_key"`
+}
+
+func (AdvisoryCveDAO) TableName() string {
+	return "advisory_cve"
+}
+
+// reference of advisory, e.g. bugzilla id
+type AdvisoryReferenceDAO struct {
+	AdvisoryID int    `json:"advisory_id" gorm:"primary_key;auto_increment:false"`
+	Reference  string `json:"reference"   gorm:"primary_key"`
+}
+
+func (AdvisoryReferenceDAO) TableName() string {
+	return "advisory_reference"
+}
+
+// product release version advisory was released for, e.g. 7.7
+type AdvisoryReleaseVersionDAO struct {
+	AdvisoryID     int    `json:"advisory_id"     gorm:"primary_key;auto_increment:false"`
+	ReleaseVersion string `json:"release_version" gorm:"primary_key"`
+}
+
+func (AdvisoryReleaseVersionDAO) TableName() string {
+	return "advisory_release_version"
+}
+
+// advisory applicable to system, patched ones are kept with time they stopped being applicable
+type SystemAdvisoriesDAO struct {
+	SystemID      int        `json:"system_id"      gorm:"primary_key;auto_increment:false"`
+	AdvisoryID    int        `json:"advisory_id"    gorm:"primary_key;auto_increment:false"`
+	FirstReported time.Time  `json:"first_reported" gorm:"not null"`
+	WhenPatched   *time.Time `json:"when_patched"`
+}
+
+func (SystemAdvisoriesDAO) TableName() string {
+	return "system_advisories"
+}
+
+// start time of the last complete sync of given data, e.g. advisories
+type SyncStateDAO struct {
+	Name     string    `json:"name"      gorm:"primary_key"`
+	LastSync time.Time `json:"last_sync" gorm:"not null"`
+}
+
+func (SyncStateDAO) TableName() string {
+	return "sync_state"
+}
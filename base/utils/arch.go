@@ -0,0 +1,39 @@
+package utils
+
+const (
+	NoArch  = "noarch"
+	SrcArch = "src"
+)
+
+// package archs installable on given system arch, besides the system arch itself and noarch
+// follows rpm's rpmrc arch_compat and yum's multilib rules
+var archCompat = map[string][]string{
+	"x86_64":  {"amd64", "ia32e", "athlon", "i686", "i586", "i486", "i386"},
+	"amd64":   {"x86_64", "ia32e", "athlon", "i686", "i586", "i486", "i386"},
+	"ia32e":   {"x86_64", "amd64", "athlon", "i686", "i586", "i486", "i386"},
+	"athlon":  {"i686", "i586", "i486", "i386"},
+	"i686":    {"i586", "i486", "i386"},
+	"i586":    {"i486", "i386"},
+	"i486":    {"i386"},
+	"aarch64": {},
+	"ppc64le": {},
+	"ppc64":   {"ppc"},
+	"s390x":   {"s390"},
+}
+
+// check whether package of pkgArch can be installed on system with systemArch
+// source packages are never installable, noarch packages always are
+func ArchCompatible(systemArch, pkgArch string) bool {
+	if pkgArch == SrcArch || pkgArch == "nosrc" {
+		return false
+	}
+	if pkgArch == systemArch || pkgArch == NoArch {
+		return true
+	}
+	for _, arch := range archCompat[systemArch] {
+		if arch == pkgArch {
+			return true
+		}
+	}
+	return false
+}
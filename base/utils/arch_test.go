@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestArchCompatible(t *testing.T) {
+	cases := []struct {
+		system, pkg string
+		res         bool
+	}{
+		{"x86_64", "x86_64", true},
+		{"x86_64", "noarch", true},
+		{"x86_64", "i686", true},
+		{"x86_64", "i386", true},
+		{"x86_64", "src", false},
+		{"x86_64", "aarch64", false},
+		{"i686", "i686", true},
+		{"i686", "i386", true},
+		{"i686", "x86_64", false},
+		{"aarch64", "aarch64", true},
+		{"aarch64", "noarch", true},
+		{"aarch64", "x86_64", false},
+		{"ppc64le", "ppc64le", true},
+		{"ppc64le", "ppc64", false},
+		{"ppc64", "ppc", true},
+		{"s390x", "s390x", true},
+		{"s390x", "s390", true},
+		{"s390x", "x86_64", false},
+		{"unknown", "unknown", true},
+		{"unknown", "noarch", true},
+		{"unknown", "i686", false},
+	}
+	for _, c := range cases {
+		assert.Equalf(t, c.res, ArchCompatible(c.system, c.pkg), "compatible(%s, %s)", c.system, c.pkg)
+	}
+}
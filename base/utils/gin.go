@@ -2,6 +2,7 @@ package utils
 
 import (
 	"github.com/gin-gonic/gin"
+	"net/http"
 	"strconv"
 )
 
@@ -29,3 +30,20 @@ func LoadParamInt(c *gin.Context, param string, defaultValue int, query bool) (i
 
 	return value, nil
 }
+
+// error envelope returned by all api endpoints
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Status int    `json:"status"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+// abort request with error envelope
+func AbortWithError(c *gin.Context, status int, detail string) {
+	c.AbortWithStatusJSON(status, ErrorResponse{Error: ErrorDetail{Status: status, Title: http.StatusText(status),
+		Detail: detail}})
+}
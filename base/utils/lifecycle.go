@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// context cancelled on SIGINT or SIGTERM
+func SignalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			Log("signal", sig.String()).Info("shutdown requested")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
+
+// how long to wait for in-flight work on shutdown, SHUTDOWN_TIMEOUT env var in seconds
+func GetShutdownTimeout() time.Duration {
+	timeout, err := strconv.Atoi(Getenv("SHUTDOWN_TIMEOUT", "30"))
+	if err != nil {
+		panic(err)
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// serve until ctx is done, then stop accepting connections and wait for in-flight requests within timeout
+func RunServer(ctx context.Context, server *http.Server, timeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// log error returned by RunServer, closed server and shutdown timeout are expected when stopping
+func LogServerError(server string, err error) {
+	switch err {
+	case nil, http.ErrServerClosed:
+	case context.DeadlineExceeded:
+		Log("server", server, "err", err.Error()).Warn("in-flight requests not finished within shutdown timeout")
+	default:
+		Log("server", server, "err", err.Error()).Error("server failed")
+	}
+}
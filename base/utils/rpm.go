@@ -2,18 +2,43 @@ package utils
 
 import (
 	"errors"
-	"regexp"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+// reasons why a package string was rejected, wrapped in ParseError
 var (
-	nevraRegex *regexp.Regexp
+	ErrMissingName    = errors.New("missing package name")
+	ErrMissingVersion = errors.New("missing version")
+	ErrMissingRelease = errors.New("missing release")
+	ErrMissingArch    = errors.New("missing arch")
+	ErrInvalidName    = errors.New("invalid character in package name")
+	ErrInvalidEpoch   = errors.New("epoch is not a number")
+	ErrDuplicateEpoch = errors.New("epoch specified twice")
+	ErrInvalidVersion = errors.New("invalid character in version")
+	ErrInvalidRelease = errors.New("invalid character in release")
+	ErrInvalidArch    = errors.New("invalid arch")
 )
 
-func init() {
-	nevraRegex = regexp.MustCompile(
-		`((?P<e1>[0-9]+):)?(?P<pn>[^:]+)-((?P<e2>[0-9]+):)?(?P<ver>[^-:]+)-(?P<rel>[^-:]+)\.(?P<arch>[a-z0-9_]+)`)
+// error returned by package string parsers
+type ParseError struct {
+	Input string
+	Err   error
 }
 
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("unable to parse %q: %s", e.Input, e.Err.Error())
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// epoch printed by rpm for packages without one, e.g. by "rpm -qa --qf '%{EPOCH}'"
+const noneEpoch = "(none)"
+
 type Nevra struct {
 	Name    string
 	Epoch   string
@@ -22,18 +47,348 @@ type Nevra struct {
 	Arch    string
 }
 
-// parse package components
+// nevra of package with numeric epoch, e.g. stored in database, zero epoch is omitted like rpm does
+func NewNevra(name string, epoch int, version, release, arch string) *Nevra {
+	nevra := Nevra{Name: name, Version: version, Release: release, Arch: arch}
+	if epoch != 0 {
+		nevra.Epoch = strconv.Itoa(epoch)
+	}
+	return &nevra
+}
+
+// epoch, version and release of a package, ordered the same way rpm orders them
+type EVR struct {
+	Epoch   int
+	Version string
+	Release string
+}
+
+// parse "name-[epoch:]version-release.arch" package string
+// also accepts leading epoch ("epoch:name-version-release.arch"), "(none)" epoch and ".rpm" suffix
 func ParseNevra(nevra string) (*Nevra, error) {
-	parsed := nevraRegex.FindStringSubmatch(nevra)
-	if len(parsed) != 9 {
-		return nil, errors.New("unable to parse nevra")
+	return parsePackage(nevra, true, true, true)
+}
+
+// parse "name-[epoch:]version-release" package string, without arch
+func ParseNevr(nevr string) (*Nevra, error) {
+	return parsePackage(nevr, true, true, false)
+}
+
+// parse "name-version-release" package string, without epoch and arch
+func ParseNvr(nvr string) (*Nevra, error) {
+	return parsePackage(nvr, true, false, false)
+}
+
+// split package string from the right, name is the only component which can contain dashes
+func parsePackage(input string, withName, withEpoch, withArch bool) (*Nevra, error) {
+	fail := func(err error) (*Nevra, error) {
+		return nil, &ParseError{Input: input, Err: err}
 	}
-	res := Nevra{
-		Name: parsed[3],
-		Epoch: parsed[2],
-		Version: parsed[6],
-		Release: parsed[7],
-		Arch: parsed[8],
+
+	var res Nevra
+	rest := input
+	hasEpoch := false
+
+	if withArch {
+		rest = strings.TrimSuffix(rest, ".rpm")
+		dot := strings.LastIndexByte(rest, '.')
+		if dot == -1 {
+			return fail(ErrMissingArch)
+		}
+		res.Arch = rest[dot+1:]
+		rest = rest[:dot]
+		if !isValidArch(res.Arch) {
+			return fail(ErrInvalidArch)
+		}
+	}
+
+	// leading epoch, "epoch:name-version-release"
+	colon := strings.IndexByte(rest, ':')
+	if withName && withEpoch && colon != -1 && colon < strings.IndexByte(rest, '-') {
+		epoch, ok := parseEpoch(rest[:colon])
+		if !ok {
+			return fail(ErrInvalidEpoch)
+		}
+		res.Epoch = epoch
+		hasEpoch = true
+		rest = rest[colon+1:]
+	}
+
+	dash := strings.LastIndexByte(rest, '-')
+	if dash == -1 {
+		return fail(ErrMissingRelease)
+	}
+	res.Release = rest[dash+1:]
+	rest = rest[:dash]
+	if res.Release == "" {
+		return fail(ErrMissingRelease)
+	}
+	if strings.IndexByte(res.Release, ':') != -1 {
+		return fail(ErrInvalidRelease)
+	}
+
+	res.Version = rest
+	if withName {
+		dash = strings.LastIndexByte(rest, '-')
+		if dash == -1 {
+			return fail(ErrMissingVersion)
+		}
+		res.Name = rest[:dash]
+		res.Version = rest[dash+1:]
+	}
+
+	if colon := strings.IndexByte(res.Version, ':'); colon != -1 && withEpoch {
+		if hasEpoch {
+			return fail(ErrDuplicateEpoch)
+		}
+		epoch, ok := parseEpoch(res.Version[:colon])
+		if !ok {
+			return fail(ErrInvalidEpoch)
+		}
+		res.Epoch = epoch
+		res.Version = res.Version[colon+1:]
+	}
+	if res.Version == "" {
+		return fail(ErrMissingVersion)
+	}
+	if strings.IndexByte(res.Version, ':') != -1 {
+		return fail(ErrInvalidVersion)
+	}
+
+	if !withName {
+		if strings.IndexByte(res.Version, '-') != -1 {
+			return fail(ErrInvalidVersion)
+		}
+		return &res, nil
+	}
+	if res.Name == "" {
+		return fail(ErrMissingName)
+	}
+	if strings.IndexByte(res.Name, ':') != -1 {
+		return fail(ErrInvalidName)
 	}
 	return &res, nil
 }
+
+// return epoch in canonical form, "(none)" is the same as no epoch at all
+func parseEpoch(epoch string) (string, bool) {
+	if epoch == noneEpoch {
+		return "", true
+	}
+	if epoch == "" {
+		return "", false
+	}
+	for i := 0; i < len(epoch); i++ {
+		if !isDigit(epoch[i]) {
+			return "", false
+		}
+	}
+	return epoch, true
+}
+
+// "rpm" is not accepted, "name-1-1.rpm.rpm" would not survive a round trip otherwise
+func isValidArch(arch string) bool {
+	if arch == "" || arch == "rpm" {
+		return false
+	}
+	for i := 0; i < len(arch); i++ {
+		if !isAlnum(arch[i]) && arch[i] != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// parse "[epoch:]version-release" string, errors are the same as of package string parsers
+func ParseEVR(evr string) (*EVR, error) {
+	parsed, err := parsePackage(evr, false, true, false)
+	if err != nil {
+		return nil, err
+	}
+	epoch := 0
+	if parsed.Epoch != "" {
+		epoch, err = strconv.Atoi(parsed.Epoch)
+		if err != nil {
+			return nil, &ParseError{Input: evr, Err: ErrInvalidEpoch}
+		}
+	}
+	return &EVR{Epoch: epoch, Version: parsed.Version, Release: parsed.Release}, nil
+}
+
+// get comparable epoch, version and release, missing epoch is treated as 0
+func (n *Nevra) EVR() EVR {
+	epoch, err := strconv.Atoi(n.Epoch)
+	if err != nil {
+		epoch = 0
+	}
+	return EVR{Epoch: epoch, Version: n.Version, Release: n.Release}
+}
+
+// format nevra back to "name-[epoch:]version-release[.arch]", parsing the result gives the same Nevra
+func (n *Nevra) String() string {
+	res := n.Name + "-"
+	if n.Epoch != "" {
+		res += n.Epoch + ":"
+	}
+	res += n.Version + "-" + n.Release
+	if n.Arch != "" {
+		res += "." + n.Arch
+	}
+	return res
+}
+
+// compare by name, then by epoch, version and release, then by arch
+// returns -1, 0 or 1, like rpm does
+func (n *Nevra) Compare(other *Nevra) int {
+	if cmp := strings.Compare(n.Name, other.Name); cmp != 0 {
+		return cmp
+	}
+	nEVR := n.EVR()
+	if cmp := nEVR.Compare(other.EVR()); cmp != 0 {
+		return cmp
+	}
+	return strings.Compare(n.Arch, other.Arch)
+}
+
+// sort packages in place, see Nevra.Compare for the ordering
+func SortNevras(nevras []*Nevra) {
+	sort.SliceStable(nevras, func(i, j int) bool {
+		return nevras[i].Compare(nevras[j]) < 0
+	})
+}
+
+// format evr as "epoch:version-release", epoch is always included
+func (e EVR) String() string {
+	return fmt.Sprintf("%d:%s-%s", e.Epoch, e.Version, e.Release)
+}
+
+// compare epoch numerically, then version and release using rpmvercmp
+func (e EVR) Compare(other EVR) int {
+	if e.Epoch != other.Epoch {
+		if e.Epoch < other.Epoch {
+			return -1
+		}
+		return 1
+	}
+	if cmp := RpmVerCmp(e.Version, other.Version); cmp != 0 {
+		return cmp
+	}
+	return RpmVerCmp(e.Release, other.Release)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || isAlpha(c)
+}
+
+// compare two version (or release) strings, port of rpmvercmp from rpm's lib/rpmvercmp.c
+// strings are split into alternating numeric and alphabetic segments, everything else is a separator,
+// '~' sorts before anything (even the end of string), '^' sorts after the end of string but before anything else
+func RpmVerCmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	one, two := a, b
+	for len(one) > 0 || len(two) > 0 {
+		for len(one) > 0 && !isAlnum(one[0]) && one[0] != '~' && one[0] != '^' {
+			one = one[1:]
+		}
+		for len(two) > 0 && !isAlnum(two[0]) && two[0] != '~' && two[0] != '^' {
+			two = two[1:]
+		}
+
+		// tilde sorts before everything else
+		oneTilde := len(one) > 0 && one[0] == '~'
+		twoTilde := len(two) > 0 && two[0] == '~'
+		if oneTilde || twoTilde {
+			if !oneTilde {
+				return 1
+			}
+			if !twoTilde {
+				return -1
+			}
+			one, two = one[1:], two[1:]
+			continue
+		}
+
+		// caret sorts after the end of string, but before any other segment
+		oneCaret := len(one) > 0 && one[0] == '^'
+		twoCaret := len(two) > 0 && two[0] == '^'
+		if oneCaret || twoCaret {
+			if len(one) == 0 {
+				return -1
+			}
+			if len(two) == 0 {
+				return 1
+			}
+			if !oneCaret {
+				return 1
+			}
+			if !twoCaret {
+				return -1
+			}
+			one, two = one[1:], two[1:]
+			continue
+		}
+
+		if len(one) == 0 || len(two) == 0 {
+			break
+		}
+
+		// grab the first completely numeric or alphabetic segment of both strings
+		isNum := isDigit(one[0])
+		segmentEnd := func(s string) int {
+			i := 0
+			for i < len(s) && ((isNum && isDigit(s[i])) || (!isNum && isAlpha(s[i]))) {
+				i++
+			}
+			return i
+		}
+		oneEnd, twoEnd := segmentEnd(one), segmentEnd(two)
+		oneSeg, twoSeg := one[:oneEnd], two[:twoEnd]
+
+		// segments of different types, numeric one is newer
+		if len(twoSeg) == 0 {
+			if isNum {
+				return 1
+			}
+			return -1
+		}
+
+		if isNum {
+			oneSeg = strings.TrimLeft(oneSeg, "0")
+			twoSeg = strings.TrimLeft(twoSeg, "0")
+			// whichever number has more digits wins
+			if len(oneSeg) > len(twoSeg) {
+				return 1
+			}
+			if len(twoSeg) > len(oneSeg) {
+				return -1
+			}
+		}
+
+		if cmp := strings.Compare(oneSeg, twoSeg); cmp != 0 {
+			return cmp
+		}
+		one, two = one[oneEnd:], two[twoEnd:]
+	}
+
+	// all segments compared identically, but separators were different
+	if len(one) == 0 && len(two) == 0 {
+		return 0
+	}
+
+	// whichever version still has characters left over wins
+	if len(one) == 0 {
+		return -1
+	}
+	return 1
+}
@@ -5,7 +5,6 @@ import (
 	"testing"
 )
 
-
 func TestNevraParse(t *testing.T) {
 	nevra, err := ParseNevra("389-ds-base-1.3.7.8-1.fc27.src")
 	assert.Equal(t, nil, err)
@@ -14,3 +13,348 @@ func TestNevraParse(t *testing.T) {
 	assert.Equal(t, "1.fc27", nevra.Release)
 	assert.Equal(t, "src", nevra.Arch)
 }
+
+// test cases taken from rpm's tests/rpmvercmp.at
+var rpmVerCmpCases = []struct {
+	a, b string
+	res  int
+}{
+	{"1.0", "1.0", 0},
+	{"1.0", "2.0", -1},
+	{"2.0", "1.0", 1},
+
+	{"2.0.1", "2.0.1", 0},
+	{"2.0", "2.0.1", -1},
+	{"2.0.1", "2.0", 1},
+
+	{"2.0.1a", "2.0.1a", 0},
+	{"2.0.1a", "2.0.1", 1},
+	{"2.0.1", "2.0.1a", -1},
+
+	{"5.5p1", "5.5p1", 0},
+	{"5.5p1", "5.5p2", -1},
+	{"5.5p2", "5.5p1", 1},
+
+	{"5.5p10", "5.5p10", 0},
+	{"5.5p1", "5.5p10", -1},
+	{"5.5p10", "5.5p1", 1},
+
+	{"10xyz", "10.1xyz", -1},
+	{"10.1xyz", "10xyz", 1},
+
+	{"xyz10", "xyz10", 0},
+	{"xyz10", "xyz10.1", -1},
+	{"xyz10.1", "xyz10", 1},
+
+	{"xyz.4", "xyz.4", 0},
+	{"xyz.4", "8", -1},
+	{"8", "xyz.4", 1},
+	{"xyz.4", "2", -1},
+	{"2", "xyz.4", 1},
+
+	{"5.5p2", "5.6p1", -1},
+	{"5.6p1", "5.5p2", 1},
+
+	{"5.6p1", "6.5p1", -1},
+	{"6.5p1", "5.6p1", 1},
+
+	{"6.0.rc1", "6.0", 1},
+	{"6.0", "6.0.rc1", -1},
+
+	{"10b2", "10a1", 1},
+	{"10a2", "10b2", -1},
+
+	{"1.0aa", "1.0aa", 0},
+	{"1.0a", "1.0aa", -1},
+	{"1.0aa", "1.0a", 1},
+
+	{"10.0001", "10.0001", 0},
+	{"10.0001", "10.1", 0},
+	{"10.1", "10.0001", 0},
+	{"10.0001", "10.0039", -1},
+	{"10.0039", "10.0001", 1},
+
+	{"4.999.9", "5.0", -1},
+	{"5.0", "4.999.9", 1},
+
+	{"20101121", "20101121", 0},
+	{"20101121", "20101122", -1},
+	{"20101122", "20101121", 1},
+
+	{"2_0", "2_0", 0},
+	{"2.0", "2_0", 0},
+	{"2_0", "2.0", 0},
+
+	{"a", "a", 0},
+	{"a+", "a+", 0},
+	{"a+", "a_", 0},
+	{"a_", "a+", 0},
+	{"+a", "+a", 0},
+	{"+a", "_a", 0},
+	{"_a", "+a", 0},
+	{"+_", "+_", 0},
+	{"_+", "+_", 0},
+	{"_+", "_", 0},
+	{"+", "_", 0},
+	{"_", "+", 0},
+
+	{"1.0~rc1", "1.0~rc1", 0},
+	{"1.0~rc1", "1.0", -1},
+	{"1.0", "1.0~rc1", 1},
+	{"1.0~rc1", "1.0~rc2", -1},
+	{"1.0~rc2", "1.0~rc1", 1},
+	{"1.0~rc1~git123", "1.0~rc1~git123", 0},
+	{"1.0~rc1~git123", "1.0~rc1", -1},
+	{"1.0~rc1", "1.0~rc1~git123", 1},
+
+	{"1.0^", "1.0^", 0},
+	{"1.0^", "1.0", 1},
+	{"1.0", "1.0^", -1},
+	{"1.0^git1", "1.0^git1", 0},
+	{"1.0^git1", "1.0", 1},
+	{"1.0", "1.0^git1", -1},
+	{"1.0^git1", "1.0^git2", -1},
+	{"1.0^git2", "1.0^git1", 1},
+	{"1.0^git1", "1.01", -1},
+	{"1.01", "1.0^git1", 1},
+	{"1.0^20160101", "1.0^20160101", 0},
+	{"1.0^20160101", "1.0.1", -1},
+	{"1.0.1", "1.0^20160101", 1},
+	{"1.0^20160101^git1", "1.0^20160101^git1", 0},
+	{"1.0^20160102", "1.0^20160101^git1", 1},
+	{"1.0^20160101^git1", "1.0^20160102", -1},
+	{"1.0~rc1^git1", "1.0~rc1^git1", 0},
+	{"1.0~rc1^git1", "1.0~rc1", 1},
+	{"1.0~rc1", "1.0~rc1^git1", -1},
+	{"1.0^git1~pre", "1.0^git1~pre", 0},
+	{"1.0^git1", "1.0^git1~pre", 1},
+	{"1.0^git1~pre", "1.0^git1", -1},
+
+	{"1b.fc17", "1b.fc17", 0},
+	{"1b.fc17", "1.fc17", -1},
+	{"1.fc17", "1b.fc17", 1},
+	{"1g.fc17", "1g.fc17", 0},
+	{"1g.fc17", "1.fc17", 1},
+	{"1.fc17", "1g.fc17", -1},
+
+	{"1.1.α", "1.1.α", 0},
+	{"1.1.α", "1.1.β", 0},
+	{"1.1.β", "1.1.α", 0},
+	{"1.1.αα", "1.1.α", 0},
+	{"1.1.α", "1.1.ββ", 0},
+	{"1.1.ββ", "1.1.αα", 0},
+}
+
+func TestRpmVerCmp(t *testing.T) {
+	for _, c := range rpmVerCmpCases {
+		assert.Equalf(t, c.res, RpmVerCmp(c.a, c.b), "rpmvercmp(%s, %s)", c.a, c.b)
+	}
+}
+
+func TestEVRCompare(t *testing.T) {
+	cases := []struct {
+		a, b EVR
+		res  int
+	}{
+		{EVR{0, "1.0", "1"}, EVR{0, "1.0", "1"}, 0},
+		{EVR{1, "1.0", "1"}, EVR{0, "2.0", "1"}, 1},
+		{EVR{0, "2.0", "1"}, EVR{1, "1.0", "1"}, -1},
+		{EVR{0, "1.0", "2.el7"}, EVR{0, "1.0", "10.el7"}, -1},
+		{EVR{0, "1.0", "1.el7_4"}, EVR{0, "1.0", "1.el7"}, 1},
+		{EVR{0, "1.0~beta", "1"}, EVR{0, "1.0", "1"}, -1},
+	}
+	for _, c := range cases {
+		assert.Equalf(t, c.res, c.a.Compare(c.b), "compare(%s, %s)", c.a, c.b)
+	}
+}
+
+func TestParseEVR(t *testing.T) {
+	evr, err := ParseEVR("1:2.0-3.el7")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, EVR{1, "2.0", "3.el7"}, *evr)
+
+	evr, err = ParseEVR("2.0-3.el7")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, EVR{0, "2.0", "3.el7"}, *evr)
+
+	evr, err = ParseEVR("(none):2.0-3.el7")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, EVR{0, "2.0", "3.el7"}, *evr)
+
+	cases := []struct {
+		input string
+		err   error
+	}{
+		{"2.0", ErrMissingRelease},
+		{"2.0-", ErrMissingRelease},
+		{"-3.el7", ErrMissingVersion},
+		{"1:-3.el7", ErrMissingVersion},
+		{"x:2.0-3.el7", ErrInvalidEpoch},
+		{"99999999999999999999:2.0-3.el7", ErrInvalidEpoch},
+		{"1:2:0-3.el7", ErrInvalidVersion},
+		{"2.0-1-3.el7", ErrInvalidVersion},
+		{"2.0-3:el7", ErrInvalidRelease},
+	}
+	for _, c := range cases {
+		_, err := ParseEVR(c.input)
+		parseErr, ok := err.(*ParseError)
+		assert.Equalf(t, true, ok, "parse(%s)", c.input)
+		if ok {
+			assert.Equalf(t, c.err, parseErr.Err, "parse(%s)", c.input)
+			assert.Equal(t, c.input, parseErr.Input)
+		}
+	}
+}
+
+func TestNevraEVRDefaultEpoch(t *testing.T) {
+	nevra, err := ParseNevra("bash-4.2.46-34.el7.x86_64")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, EVR{0, "4.2.46", "34.el7"}, nevra.EVR())
+}
+
+func TestNevraString(t *testing.T) {
+	assert.Equal(t, "bash-4.2.46-34.el7.x86_64",
+		(&Nevra{Name: "bash", Version: "4.2.46", Release: "34.el7", Arch: "x86_64"}).String())
+	assert.Equal(t, "bash-1:4.2.46-34.el7.x86_64",
+		(&Nevra{Name: "bash", Epoch: "1", Version: "4.2.46", Release: "34.el7", Arch: "x86_64"}).String())
+}
+
+func TestNewNevra(t *testing.T) {
+	assert.Equal(t, "bash-4.2.46-34.el7.x86_64", NewNevra("bash", 0, "4.2.46", "34.el7", "x86_64").String())
+	assert.Equal(t, "openssl-1:1.0.2k-19.el7.x86_64", NewNevra("openssl", 1, "1.0.2k", "19.el7", "x86_64").String())
+}
+
+func TestSortNevras(t *testing.T) {
+	var nevras []*Nevra
+	for _, s := range []string{
+		"kernel-3.10.0-1062.el7.x86_64",
+		"bash-4.2.46-34.el7.x86_64",
+		"kernel-3.10.0-957.el7.x86_64",
+		"kernel-3.10.0-1062.1.1.el7.x86_64",
+		"bash-4.2.46-31.el7.x86_64",
+	} {
+		nevra, err := ParseNevra(s)
+		assert.Equal(t, nil, err)
+		nevras = append(nevras, nevra)
+	}
+	SortNevras(nevras)
+
+	var sorted []string
+	for _, nevra := range nevras {
+		sorted = append(sorted, nevra.String())
+	}
+	assert.Equal(t, []string{
+		"bash-4.2.46-31.el7.x86_64",
+		"bash-4.2.46-34.el7.x86_64",
+		"kernel-3.10.0-957.el7.x86_64",
+		"kernel-3.10.0-1062.el7.x86_64",
+		"kernel-3.10.0-1062.1.1.el7.x86_64",
+	}, sorted)
+}
+
+func TestNevraParseFormats(t *testing.T) {
+	cases := []struct {
+		input string
+		nevra Nevra
+	}{
+		{"bash-4.2.46-34.el7.x86_64", Nevra{"bash", "", "4.2.46", "34.el7", "x86_64"}},
+		{"bash-0:4.2.46-34.el7.x86_64", Nevra{"bash", "0", "4.2.46", "34.el7", "x86_64"}},
+		{"1:NetworkManager-1.18.0-5.el7.x86_64", Nevra{"NetworkManager", "1", "1.18.0", "5.el7", "x86_64"}},
+		{"NetworkManager-1:1.18.0-5.el7.x86_64", Nevra{"NetworkManager", "1", "1.18.0", "5.el7", "x86_64"}},
+		{"bash-(none):4.2.46-34.el7.x86_64", Nevra{"bash", "", "4.2.46", "34.el7", "x86_64"}},
+		{"bash-4.2.46-34.el7.x86_64.rpm", Nevra{"bash", "", "4.2.46", "34.el7", "x86_64"}},
+		{"python3-3.6.8-13.el8.x86_64", Nevra{"python3", "", "3.6.8", "13.el8", "x86_64"}},
+		{"python3-3-3.6.8-13.el8.noarch", Nevra{"python3-3", "", "3.6.8", "13.el8", "noarch"}},
+		{"kernel-rt-4.18.0-80.rt9.138.el8.x86_64", Nevra{"kernel-rt", "", "4.18.0", "80.rt9.138.el8", "x86_64"}},
+		{"389-ds-base-1.4.0.20-10.module+el8.0.0+3096+101825d5.x86_64",
+			Nevra{"389-ds-base", "", "1.4.0.20", "10.module+el8.0.0+3096+101825d5", "x86_64"}},
+		{"perl-Net-SSLeay-1.88-1.module_el8.3.0+410+ff426aa3.x86_64",
+			Nevra{"perl-Net-SSLeay", "", "1.88", "1.module_el8.3.0+410+ff426aa3", "x86_64"}},
+		{"libstdc++-8.3.1-4.5.el8.i686", Nevra{"libstdc++", "", "8.3.1", "4.5.el8", "i686"}},
+		{"vim-minimal-2:7.4.629-6.el7.x86_64", Nevra{"vim-minimal", "2", "7.4.629", "6.el7", "x86_64"}},
+		{"gpg-pubkey-fd431d51-4ae0493b.(none)", Nevra{}},
+	}
+	for _, c := range cases {
+		nevra, err := ParseNevra(c.input)
+		if c.nevra.Name == "" {
+			assert.NotEqual(t, nil, err)
+			continue
+		}
+		assert.Equalf(t, nil, err, "parse(%s)", c.input)
+		assert.Equalf(t, c.nevra, *nevra, "parse(%s)", c.input)
+	}
+}
+
+func TestNevraParseErrors(t *testing.T) {
+	cases := []struct {
+		input string
+		err   error
+	}{
+		{"bash", ErrMissingArch},
+		{"bash.x86_64", ErrMissingRelease},
+		{"bash-4.2.46.x86_64", ErrMissingVersion},
+		{"-4.2.46-34.el7.x86_64", ErrMissingName},
+		{"bash--34.el7.x86_64", ErrMissingVersion},
+		{"bash-4.2.46-.x86_64", ErrMissingRelease},
+		{"bash-4.2.46-34.el7.", ErrInvalidArch},
+		{"bash-4.2.46-34.el7.x86-64", ErrInvalidArch},
+		{"bash-x:4.2.46-34.el7.x86_64", ErrInvalidEpoch},
+		{"1:bash-2:4.2.46-34.el7.x86_64", ErrDuplicateEpoch},
+		{"bash-1:4.2:46-34.el7.x86_64", ErrInvalidVersion},
+		{"bash-4.2.46-34:el7.x86_64", ErrInvalidRelease},
+		{"ba:sh-4.2.46-34.el7.x86_64", ErrInvalidEpoch},
+	}
+	for _, c := range cases {
+		_, err := ParseNevra(c.input)
+		parseErr, ok := err.(*ParseError)
+		assert.Equalf(t, true, ok, "parse(%s)", c.input)
+		if ok {
+			assert.Equalf(t, c.err, parseErr.Err, "parse(%s)", c.input)
+			assert.Equal(t, c.input, parseErr.Input)
+		}
+	}
+}
+
+func TestNevrAndNvrParse(t *testing.T) {
+	nevra, err := ParseNevr("bash-1:4.2.46-34.el7")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Nevra{"bash", "1", "4.2.46", "34.el7", ""}, *nevra)
+	assert.Equal(t, "bash-1:4.2.46-34.el7", nevra.String())
+
+	nevra, err = ParseNvr("389-ds-base-1.3.7.8-1.fc27")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Nevra{"389-ds-base", "", "1.3.7.8", "1.fc27", ""}, *nevra)
+
+	_, err = ParseNvr("bash-1:4.2.46-34.el7")
+	assert.Equal(t, ErrInvalidVersion, err.(*ParseError).Err)
+}
+
+func FuzzParseNevra(f *testing.F) {
+	for _, s := range []string{
+		"bash-4.2.46-34.el7.x86_64",
+		"1:NetworkManager-1.18.0-5.el7.x86_64",
+		"bash-(none):4.2.46-34.el7.x86_64",
+		"bash-4.2.46-34.el7.x86_64.rpm",
+		"389-ds-base-1.4.0.20-10.module+el8.0.0+3096+101825d5.x86_64",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		for _, parse := range []func(string) (*Nevra, error){ParseNevra, ParseNevr, ParseNvr} {
+			nevra, err := parse(input)
+			if err != nil {
+				if _, ok := err.(*ParseError); !ok {
+					t.Fatalf("unexpected error type %T for %q", err, input)
+				}
+				continue
+			}
+			again, err := parse(nevra.String())
+			if err != nil {
+				t.Fatalf("unable to parse %q formatted from %q: %v", nevra.String(), input, err)
+			}
+			if *again != *nevra {
+				t.Fatalf("round trip of %q changed %+v to %+v", input, *nevra, *again)
+			}
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package vmaas
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const updatesPath = "/api/v3/updates"
+
+type UpdatesRequest struct {
+	PackageList    []string `json:"package_list"`
+	RepositoryList []string `json:"repository_list,omitempty"`
+	ModulesList    []Module `json:"modules_list,omitempty"`
+	Releasever     string   `json:"releasever,omitempty"`
+	Basearch       string   `json:"basearch,omitempty"`
+}
+
+// enabled module stream
+type Module struct {
+	Name   string `json:"module_name"`
+	Stream string `json:"module_stream"`
+}
+
+type UpdatesResponse struct {
+	// requested nevra -> its updates
+	UpdateList     map[string]UpdateListItem `json:"update_list"`
+	RepositoryList []string                  `json:"repository_list,omitempty"`
+	ModulesList    []Module                  `json:"modules_list,omitempty"`
+	Releasever     string                    `json:"releasever,omitempty"`
+	Basearch       string                    `json:"basearch,omitempty"`
+}
+
+type UpdateListItem struct {
+	AvailableUpdates []AvailableUpdate `json:"available_updates"`
+}
+
+// package nevra which updates the requested one and the erratum (advisory) it comes from
+type AvailableUpdate struct {
+	Package    string `json:"package"`
+	Erratum    string `json:"erratum"`
+	Repository string `json:"repository"`
+	Basearch   string `json:"basearch"`
+	Releasever string `json:"releasever"`
+}
+
+type Config struct {
+	// of single http request, retries have their own
+	Timeout time.Duration
+	// max number of packages in one request, longer package lists are split
+	BatchSize   int
+	MaxAttempts int
+	// wait time before next attempt, multiplied by the attempt number
+	RetryDelay time.Duration
+}
+
+var DefaultConfig = Config{Timeout: 60 * time.Second, BatchSize: 1000, MaxAttempts: 3, RetryDelay: time.Second}
+
+// client of VMaaS-like updates service
+type Client struct {
+	address string
+	client  *http.Client
+	config  Config
+}
+
+func NewClient(address string, config Config) *Client {
+	return &Client{address: strings.TrimSuffix(address, "/"), client: &http.Client{Timeout: config.Timeout},
+		config: config}
+}
+
+// error which won't go away by retrying
+type permanentError struct {
+	error
+}
+
+// updates of all requested packages, package list is sent in batches
+func (c *Client) Updates(ctx context.Context, request *UpdatesRequest) (*UpdatesResponse, error) {
+	res := UpdatesResponse{UpdateList: map[string]UpdateListItem{}, RepositoryList: request.RepositoryList,
+		ModulesList: request.ModulesList, Releasever: request.Releasever, Basearch: request.Basearch}
+	batchSize := c.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(request.PackageList)
+	}
+
+	for start := 0; start < len(request.PackageList); start += batchSize {
+		end := start + batchSize
+		if end > len(request.PackageList) {
+			end = len(request.PackageList)
+		}
+		batch := *request
+		batch.PackageList = request.PackageList[start:end]
+
+		resp, err := c.updatesWithRetries(ctx, &batch)
+		if err != nil {
+			return nil, err
+		}
+		for nevra, item := range resp.UpdateList {
+			res.UpdateList[nevra] = item
+		}
+	}
+	return &res, nil
+}
+
+func (c *Client) updatesWithRetries(ctx context.Context, request *UpdatesRequest) (*UpdatesResponse, error) {
+	maxAttempts := c.config.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var resp *UpdatesResponse
+		resp, err = c.updates(ctx, request)
+		if err == nil {
+			return resp, nil
+		}
+		if permanent, ok := err.(permanentError); ok {
+			return nil, permanent.error
+		}
+		if attempt < maxAttempts {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(c.config.RetryDelay * time.Duration(attempt)):
+			}
+		}
+	}
+	return nil, err
+}
+
+// single request with gzipped body, gzipped response is accepted
+func (c *Client) updates(ctx context.Context, request *UpdatesRequest) (*UpdatesResponse, error) {
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	err := json.NewEncoder(gz).Encode(request)
+	if err != nil {
+		return nil, permanentError{err}
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, permanentError{err}
+	}
+
+	httpRequest, err := http.NewRequest(http.MethodPost, c.address+updatesPath, &body)
+	if err != nil {
+		return nil, permanentError{err}
+	}
+	httpRequest = httpRequest.WithContext(ctx)
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("Content-Encoding", "gzip")
+	httpRequest.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := c.client.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = fmt.Errorf("updates request failed, status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+		// client errors won't be fixed by retrying, except for rate limiting
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, permanentError{err}
+		}
+		return nil, err
+	}
+
+	reader := resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		reader, err = gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var res UpdatesResponse
+	err = json.NewDecoder(reader).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+	if res.UpdateList == nil {
+		return nil, errors.New("updates response without update_list")
+	}
+	return &res, nil
+}
@@ -0,0 +1,91 @@
+package vmaas
+
+import (
+	"context"
+	"github.com/bmizerany/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testConfig = Config{Timeout: time.Second, BatchSize: 2, MaxAttempts: 3, RetryDelay: time.Millisecond}
+
+func TestUpdates(t *testing.T) {
+	server := NewFakeServer(nil)
+	defer server.Close()
+	client := NewClient(server.URL+"/", testConfig)
+
+	resp, err := client.Updates(context.Background(), &UpdatesRequest{
+		PackageList: []string{"bash-4.2.46-34.el7.x86_64", "kernel-3.10.0-1062.el7.x86_64", "tzdata-2019c-1.el7.noarch"},
+		Basearch:    "x86_64",
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(resp.UpdateList))
+	assert.Equal(t, "RHSA-2020:0001", resp.UpdateList["bash-4.2.46-34.el7.x86_64"].AvailableUpdates[0].Erratum)
+	assert.Equal(t, 2, len(resp.UpdateList["kernel-3.10.0-1062.el7.x86_64"].AvailableUpdates))
+	assert.Equal(t, 0, len(resp.UpdateList["tzdata-2019c-1.el7.noarch"].AvailableUpdates))
+	assert.Equal(t, "x86_64", resp.Basearch)
+
+	// split into batches
+	requests := server.Requests()
+	assert.Equal(t, 2, len(requests))
+	assert.Equal(t, 2, len(requests[0].PackageList))
+	assert.Equal(t, []string{"tzdata-2019c-1.el7.noarch"}, requests[1].PackageList)
+}
+
+func TestUpdatesRepos(t *testing.T) {
+	server := NewFakeServer(nil)
+	defer server.Close()
+	client := NewClient(server.URL, testConfig)
+
+	resp, err := client.Updates(context.Background(), &UpdatesRequest{
+		PackageList:    []string{"bash-4.2.46-34.el7.x86_64"},
+		RepositoryList: []string{"rhel-7-server-extras-rpms"},
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(resp.UpdateList["bash-4.2.46-34.el7.x86_64"].AvailableUpdates))
+}
+
+func TestUpdatesRetry(t *testing.T) {
+	server := NewFakeServer(nil)
+	defer server.Close()
+	client := NewClient(server.URL, testConfig)
+
+	server.FailNext(2)
+	resp, err := client.Updates(context.Background(), &UpdatesRequest{PackageList: []string{"bash-4.2.46-34.el7.x86_64"}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(resp.UpdateList))
+	assert.Equal(t, 3, len(server.Requests()))
+
+	server.FailNext(3)
+	_, err = client.Updates(context.Background(), &UpdatesRequest{PackageList: []string{"bash-4.2.46-34.el7.x86_64"}})
+	assert.Equal(t, "updates request failed, status 503: service unavailable", err.Error())
+}
+
+func TestUpdatesClientError(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "invalid package list", http.StatusBadRequest)
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, testConfig)
+
+	_, err := client.Updates(context.Background(), &UpdatesRequest{PackageList: []string{"bash"}})
+	assert.Equal(t, true, strings.HasPrefix(err.Error(), "updates request failed, status 400"))
+	// not retried
+	assert.Equal(t, 1, attempts)
+}
+
+func TestUpdatesTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, Config{Timeout: 10 * time.Millisecond, MaxAttempts: 1})
+
+	_, err := client.Updates(context.Background(), &UpdatesRequest{PackageList: []string{"bash"}})
+	assert.NotEqual(t, nil, err)
+}
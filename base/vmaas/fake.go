@@ -0,0 +1,134 @@
+package vmaas
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// updates of packages served by FakeServer, by requested nevra
+type Fixture map[string][]AvailableUpdate
+
+// fixture used when FakeServer is created without one
+const defaultFixture = `{
+	"bash-4.2.46-34.el7.x86_64": [
+		{"package": "bash-4.2.46-35.el7_9.x86_64", "erratum": "RHSA-2020:0001", "repository": "rhel-7-server-rpms",
+		 "basearch": "x86_64", "releasever": "7Server"}
+	],
+	"kernel-3.10.0-1062.el7.x86_64": [
+		{"package": "kernel-3.10.0-1062.1.1.el7.x86_64", "erratum": "RHBA-2020:0002", "repository": "rhel-7-server-rpms",
+		 "basearch": "x86_64", "releasever": "7Server"},
+		{"package": "kernel-3.10.0-1062.4.1.el7.x86_64", "erratum": "RHSA-2020:0003", "repository": "rhel-7-server-rpms",
+		 "basearch": "x86_64", "releasever": "7Server"}
+	]
+}`
+
+func DefaultFixture() Fixture {
+	var fixture Fixture
+	err := json.Unmarshal([]byte(defaultFixture), &fixture)
+	if err != nil {
+		panic(err)
+	}
+	return fixture
+}
+
+// in-process stand-in of updates service for tests and local development
+// available updates are filtered by requested repositories, when there are any
+type FakeServer struct {
+	*httptest.Server
+	fixture  Fixture
+	lock     sync.Mutex
+	requests []UpdatesRequest
+	// number of next requests answered with 503
+	failures int
+}
+
+func NewFakeServer(fixture Fixture) *FakeServer {
+	if fixture == nil {
+		fixture = DefaultFixture()
+	}
+	server := FakeServer{fixture: fixture}
+	mux := http.NewServeMux()
+	mux.HandleFunc(updatesPath, server.handleUpdates)
+	server.Server = httptest.NewServer(mux)
+	return &server
+}
+
+// received requests, including the failed ones
+func (s *FakeServer) Requests() []UpdatesRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]UpdatesRequest(nil), s.requests...)
+}
+
+// answer next n requests with 503 Service Unavailable
+func (s *FakeServer) FailNext(n int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failures = n
+}
+
+func (s *FakeServer) handleUpdates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+	var request UpdatesRequest
+	err := json.NewDecoder(body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.lock.Lock()
+	s.requests = append(s.requests, request)
+	fail := s.failures > 0
+	if fail {
+		s.failures--
+	}
+	s.lock.Unlock()
+	if fail {
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	repos := map[string]bool{}
+	for _, repo := range request.RepositoryList {
+		repos[repo] = true
+	}
+	resp := UpdatesResponse{UpdateList: map[string]UpdateListItem{}, RepositoryList: request.RepositoryList,
+		ModulesList: request.ModulesList, Releasever: request.Releasever, Basearch: request.Basearch}
+	for _, nevra := range request.PackageList {
+		updates := []AvailableUpdate{}
+		for _, update := range s.fixture[nevra] {
+			if len(repos) == 0 || repos[update.Repository] {
+				updates = append(updates, update)
+			}
+		}
+		resp.UpdateList[nevra] = UpdateListItem{AvailableUpdates: updates}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Header.Get("Accept-Encoding") == "gzip" {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		_ = json.NewEncoder(gz).Encode(resp)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
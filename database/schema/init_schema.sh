@@ -7,8 +7,7 @@ if $PG_INITIALIZED ; then
     # Need to make sure admin role has createrole attribute
     psql -c "ALTER USER ${POSTGRESQL_USER} WITH CREATEROLE" -d ${POSTGRESQL_DATABASE}
 
-    # Init database schema
-    psql -U ${POSTGRESQL_USER} -d ${POSTGRESQL_DATABASE} -f ${CONTAINER_SCRIPTS_PATH}/start/create_schema.sql
+    # Schema is created by "migrate up" command of the application
 
 else
   echo "Schema initialization skipped."
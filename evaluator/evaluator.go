@@ -0,0 +1,290 @@
+package evaluator
+
+import (
+	"app/base/database"
+	"app/base/structures"
+	"app/base/utils"
+	"app/base/vmaas"
+	"encoding/json"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// installed packages, arch, enabled repos and module streams of evaluated system
+type SystemProfile struct {
+	Packages []string
+	Arch     string
+	Repos    []string
+	Modules  []vmaas.Module
+}
+
+// advisories applicable to system and the latest available update of each installed package
+type Evaluation struct {
+	// advisory names
+	Advisories []string
+	// installed nevra -> nevra of the latest update, only for packages which can be updated
+	Updates map[string]string
+}
+
+// computes evaluation of system profile
+type Backend interface {
+	Evaluate(tx *gorm.DB, profile *SystemProfile) (*Evaluation, error)
+}
+
+var backend Backend = &localBackend{}
+
+// choose evaluation backend, "vmaas" external updates service, "local" synced advisories
+// only vmaas restricts updates to enabled repositories and module streams, local is meant for development
+func Configure() {
+	name := utils.Getenv("EVALUATOR_BACKEND", "vmaas")
+	switch name {
+	case "local":
+		utils.Log().Warn("local evaluator ignores enabled repositories and module streams, use it for development only")
+		backend = &localBackend{}
+	case "vmaas":
+		config := vmaas.DefaultConfig
+		timeout, err := strconv.Atoi(utils.Getenv("VMAAS_TIMEOUT", "60"))
+		if err != nil {
+			panic(err)
+		}
+		config.Timeout = time.Duration(timeout) * time.Second
+		config.BatchSize, err = strconv.Atoi(utils.Getenv("VMAAS_BATCH_SIZE", strconv.Itoa(config.BatchSize)))
+		if err != nil {
+			panic(err)
+		}
+		config.MaxAttempts, err = strconv.Atoi(utils.Getenv("VMAAS_MAX_ATTEMPTS", strconv.Itoa(config.MaxAttempts)))
+		if err != nil {
+			panic(err)
+		}
+		backend = &remoteBackend{client: vmaas.NewClient(utils.GetenvOrFail("VMAAS_ADDRESS"), config)}
+	default:
+		panic(fmt.Sprintf("Unknown evaluator backend '%s'", name))
+	}
+	utils.Log("backend", name).Info("evaluator configured")
+}
+
+// package installed on evaluated system
+type installedPackage struct {
+	PackageID  int
+	Name       string
+	Epoch      int
+	Version    string
+	Release    string
+	Arch       string
+	LatestEvra *string
+}
+
+func (p *installedPackage) nevra() *utils.Nevra {
+	return utils.NewNevra(p.Name, p.Epoch, p.Version, p.Release, p.Arch)
+}
+
+// "epoch:version-release.arch" stored as latest update of installed package
+func evra(nevra *utils.Nevra) string {
+	return fmt.Sprintf("%s.%s", nevra.EVR().String(), nevra.Arch)
+}
+
+// evaluate stored system in given transaction, store applicable advisories,
+// latest updates of its packages and advisory counts
+func EvaluateSystem(tx *gorm.DB, systemID int) error {
+	var host structures.HostDAO
+	err := tx.Where("id = ?", systemID).First(&host).Error
+	if err != nil {
+		return err
+	}
+	if host.OptOut {
+		return nil
+	}
+
+	installed, err := loadInstalled(tx, systemID)
+	if err != nil {
+		return err
+	}
+	profile, err := systemProfile(&host, installed)
+	if err != nil {
+		return err
+	}
+
+	evaluation, err := backend.Evaluate(tx, profile)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = updateLatest(tx, systemID, installed, evaluation.Updates)
+	if err != nil {
+		return err
+	}
+	err = updateAdvisories(tx, systemID, evaluation.Advisories, now)
+	if err != nil {
+		return err
+	}
+	err = updateCounts(tx, systemID, now)
+	if err != nil {
+		return err
+	}
+	utils.Log("systemID", systemID, "advisories", len(evaluation.Advisories), "updates", len(evaluation.Updates)).
+		Debug("system evaluated")
+	return nil
+}
+
+func loadInstalled(tx *gorm.DB, systemID int) ([]installedPackage, error) {
+	var installed []installedPackage
+	err := tx.Table("system_package sp").
+		Select("sp.package_id, pn.name, p.epoch, p.version, p.release, p.arch, sp.latest_evra").
+		Joins("JOIN package p ON p.id = sp.package_id").
+		Joins("JOIN package_name pn ON pn.id = p.name_id").
+		Where("sp.system_id = ?", systemID).
+		Scan(&installed).Error
+	return installed, err
+}
+
+// arch, repos and modules are taken from uploaded profile, installed packages from database
+func systemProfile(host *structures.HostDAO, installed []installedPackage) (*SystemProfile, error) {
+	var profile SystemProfile
+	if host.Request != "" {
+		var request struct {
+			Arch    string          `json:"arch"`
+			Repos   *[]string       `json:"repos"`
+			Modules *[]vmaas.Module `json:"modules"`
+		}
+		err := json.Unmarshal([]byte(host.Request), &request)
+		if err != nil {
+			return nil, err
+		}
+		profile.Arch = request.Arch
+		if request.Repos != nil {
+			profile.Repos = *request.Repos
+		}
+		if request.Modules != nil {
+			profile.Modules = *request.Modules
+		}
+	}
+
+	for i := range installed {
+		profile.Packages = append(profile.Packages, installed[i].nevra().String())
+	}
+	return &profile, nil
+}
+
+// set latest_evra of installed packages, only changed rows are written
+func updateLatest(tx *gorm.DB, systemID int, installed []installedPackage, updates map[string]string) error {
+	for i := range installed {
+		pkg := &installed[i]
+		var latest *string
+		if update, ok := updates[pkg.nevra().String()]; ok {
+			nevra, err := utils.ParseNevra(update)
+			if err != nil {
+				return err
+			}
+			value := evra(nevra)
+			latest = &value
+		}
+		if equal(latest, pkg.LatestEvra) {
+			continue
+		}
+		err := tx.Model(&structures.SystemPackageDAO{}).
+			Where("system_id = ? AND package_id = ?", systemID, pkg.PackageID).
+			Update("latest_evra", latest).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func equal(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// add newly applicable advisories, mark no longer applicable ones as patched
+// and reopen patched ones which are applicable again
+func updateAdvisories(tx *gorm.DB, systemID int, names []string, now time.Time) error {
+	applicable := map[int]bool{}
+	err := database.InChunks(len(names), func(start, end int) error {
+		var advisories []structures.AdvisoryMetadataDAO
+		err := tx.Select("id").Where("name IN (?)", names[start:end]).Find(&advisories).Error
+		for _, advisory := range advisories {
+			applicable[advisory.ID] = true
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(applicable) < len(names) {
+		utils.Log("systemID", systemID, "unknown", len(names)-len(applicable)).Warn("unknown advisories skipped")
+	}
+
+	var stored []structures.SystemAdvisoriesDAO
+	err = tx.Where("system_id = ?", systemID).Find(&stored).Error
+	if err != nil {
+		return err
+	}
+	for _, item := range stored {
+		isApplicable := applicable[item.AdvisoryID]
+		delete(applicable, item.AdvisoryID)
+		if isApplicable == (item.WhenPatched == nil) {
+			continue
+		}
+		var whenPatched *time.Time
+		if !isApplicable {
+			whenPatched = &now
+		}
+		err = tx.Model(&structures.SystemAdvisoriesDAO{}).
+			Where("system_id = ? AND advisory_id = ?", systemID, item.AdvisoryID).
+			Update("when_patched", whenPatched).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	added := make([]int, 0, len(applicable))
+	for id := range applicable {
+		added = append(added, id)
+	}
+	sort.Ints(added)
+	for _, id := range added {
+		err = tx.Create(&structures.SystemAdvisoriesDAO{SystemID: systemID, AdvisoryID: id, FirstReported: now}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cache counts of applicable advisories by type on the system row
+func updateCounts(tx *gorm.DB, systemID int, now time.Time) error {
+	var counts []struct {
+		AdvisoryType string
+		Count        int
+	}
+	err := tx.Table("system_advisories sa").
+		Select("am.advisory_type, count(*) AS count").
+		Joins("JOIN advisory_metadata am ON am.id = sa.advisory_id").
+		Where("sa.system_id = ? AND sa.when_patched IS NULL", systemID).
+		Group("am.advisory_type").
+		Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+
+	byType := map[string]int{}
+	total := 0
+	for _, count := range counts {
+		byType[count.AdvisoryType] = count.Count
+		total += count.Count
+	}
+	return tx.Model(&structures.HostDAO{}).Where("id = ?", systemID).Updates(map[string]interface{}{
+		"advisory_count_cache":     total,
+		"advisory_enh_count_cache": byType["enhancement"],
+		"advisory_bug_count_cache": byType["bugfix"],
+		"advisory_sec_count_cache": byType["security"],
+		"last_evaluation":          now,
+	}).Error
+}
@@ -0,0 +1,184 @@
+package evaluator
+
+import (
+	"app/base/core"
+	"app/base/database"
+	"app/base/structures"
+	"app/base/utils"
+	"context"
+	"github.com/bmizerany/assert"
+	"github.com/jinzhu/gorm"
+	"testing"
+	"time"
+)
+
+func createAdvisory(t *testing.T, name, advisoryType string, packages ...string) {
+	advisory := structures.AdvisoryMetadataDAO{Name: name, AdvisoryType: advisoryType, Synopsis: name,
+		Description: name, Issued: time.Now(), Updated: time.Now()}
+	assert.Equal(t, nil, database.Db.Create(&advisory).Error)
+	ids, err := database.GetOrCreatePackages(database.Db, packages)
+	assert.Equal(t, nil, err)
+	for _, id := range ids {
+		assert.Equal(t, nil, database.Db.Create(&structures.AdvisoryPackageDAO{AdvisoryID: advisory.ID,
+			PackageID: id}).Error)
+	}
+}
+
+func createSystem(t *testing.T, id int, arch string) {
+	host := structures.HostDAO{ID: id, InventoryID: "INV-1", Request: `{"arch":"` + arch + `"}`, Checksum: "1"}
+	assert.Equal(t, nil, database.Db.Create(&host).Error)
+}
+
+// replace packages installed on system
+func installPackages(t *testing.T, systemID int, packages ...string) {
+	assert.Equal(t, nil, database.Db.Where("system_id = ?", systemID).Delete(&structures.SystemPackageDAO{}).Error)
+	ids, err := database.GetOrCreatePackages(database.Db, packages)
+	assert.Equal(t, nil, err)
+	for _, id := range ids {
+		assert.Equal(t, nil, database.Db.Create(&structures.SystemPackageDAO{SystemID: systemID, PackageID: id}).Error)
+	}
+}
+
+func evaluate(t *testing.T, systemID int) structures.HostDAO {
+	err := database.Transaction(func(tx *gorm.DB) error {
+		return EvaluateSystem(tx, systemID)
+	})
+	assert.Equal(t, nil, err)
+	var host structures.HostDAO
+	assert.Equal(t, nil, database.Db.Where("id = ?", systemID).First(&host).Error)
+	return host
+}
+
+func latestUpdates(t *testing.T, systemID int) map[string]string {
+	installed, err := loadInstalled(database.Db, systemID)
+	assert.Equal(t, nil, err)
+	res := map[string]string{}
+	for _, pkg := range installed {
+		if pkg.LatestEvra != nil {
+			res[pkg.Name] = *pkg.LatestEvra
+		}
+	}
+	return res
+}
+
+func systemAdvisories(t *testing.T, systemID int) map[string]structures.SystemAdvisoriesDAO {
+	var advisories []structures.AdvisoryMetadataDAO
+	assert.Equal(t, nil, database.Db.Find(&advisories).Error)
+	var items []structures.SystemAdvisoriesDAO
+	assert.Equal(t, nil, database.Db.Where("system_id = ?", systemID).Find(&items).Error)
+	res := map[string]structures.SystemAdvisoriesDAO{}
+	for _, item := range items {
+		for _, advisory := range advisories {
+			if advisory.ID == item.AdvisoryID {
+				res[advisory.Name] = item
+			}
+		}
+	}
+	return res
+}
+
+func setupAdvisories(t *testing.T) {
+	createAdvisory(t, "RHSA-2019:0001", "security", "bash-4.2.46-35.el7.x86_64", "bash-4.2.46-35.el7.i686")
+	createAdvisory(t, "RHBA-2019:0002", "bugfix", "kernel-3.10.0-1062.1.1.el7.x86_64")
+	createAdvisory(t, "RHBA-2019:0003", "bugfix", "kernel-3.10.0-1062.4.1.el7.x86_64")
+	// older than installed
+	createAdvisory(t, "RHSA-2019:0004", "security", "bash-4.2.46-33.el7.x86_64")
+	// package not installed on x86_64 system
+	createAdvisory(t, "RHEA-2019:0005", "enhancement", "kernel-3.10.0-1062.9.1.el7.ppc64le")
+}
+
+func TestEvaluateSystem(t *testing.T) {
+	core.SetupTestEnvironment()
+	setupAdvisories(t)
+	createSystem(t, 1, "x86_64")
+	installPackages(t, 1, "bash-4.2.46-34.el7.x86_64", "kernel-3.10.0-1062.el7.x86_64", "tzdata-2019c-1.el7.noarch")
+
+	host := evaluate(t, 1)
+	assert.Equal(t, 3, host.AdvisoryCountCache)
+	assert.Equal(t, 1, host.AdvisorySecCountCache)
+	assert.Equal(t, 2, host.AdvisoryBugCountCache)
+	assert.Equal(t, 0, host.AdvisoryEnhCountCache)
+	assert.NotEqual(t, (*time.Time)(nil), host.LastEvaluation)
+
+	advisories := systemAdvisories(t, 1)
+	assert.Equal(t, 3, len(advisories))
+	assert.Equal(t, (*time.Time)(nil), advisories["RHSA-2019:0001"].WhenPatched)
+	assert.Equal(t, map[string]string{"bash": "0:4.2.46-35.el7.x86_64", "kernel": "0:3.10.0-1062.4.1.el7.x86_64"},
+		latestUpdates(t, 1))
+}
+
+func TestEvaluatePatched(t *testing.T) {
+	core.SetupTestEnvironment()
+	setupAdvisories(t)
+	createSystem(t, 1, "x86_64")
+	installPackages(t, 1, "bash-4.2.46-34.el7.x86_64")
+	evaluate(t, 1)
+	reported := systemAdvisories(t, 1)["RHSA-2019:0001"].FirstReported
+
+	// updated system, advisory is kept as patched
+	installPackages(t, 1, "bash-4.2.46-35.el7.x86_64")
+	host := evaluate(t, 1)
+	assert.Equal(t, 0, host.AdvisoryCountCache)
+	advisory := systemAdvisories(t, 1)["RHSA-2019:0001"]
+	assert.NotEqual(t, (*time.Time)(nil), advisory.WhenPatched)
+	assert.Equal(t, map[string]string{}, latestUpdates(t, 1))
+
+	// downgraded system, advisory is applicable again since first report
+	installPackages(t, 1, "bash-4.2.46-34.el7.x86_64")
+	host = evaluate(t, 1)
+	assert.Equal(t, 1, host.AdvisoryCountCache)
+	advisory = systemAdvisories(t, 1)["RHSA-2019:0001"]
+	assert.Equal(t, (*time.Time)(nil), advisory.WhenPatched)
+	assert.Equal(t, true, advisory.FirstReported.Equal(reported))
+}
+
+func TestEvaluateAll(t *testing.T) {
+	core.SetupTestEnvironment()
+	setupAdvisories(t)
+	createSystem(t, 1, "x86_64")
+	installPackages(t, 1, "bash-4.2.46-34.el7.x86_64")
+
+	evaluated, failed, err := evaluateAll(context.Background())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, evaluated)
+	assert.Equal(t, 0, failed)
+	assert.Equal(t, 1, len(systemAdvisories(t, 1)))
+}
+
+func TestEvaluateOptOut(t *testing.T) {
+	core.SetupTestEnvironment()
+	setupAdvisories(t)
+	createSystem(t, 1, "x86_64")
+	installPackages(t, 1, "bash-4.2.46-34.el7.x86_64")
+	assert.Equal(t, nil, database.Db.Model(&structures.HostDAO{ID: 1}).Update("opt_out", true).Error)
+
+	evaluated, _, err := evaluateAll(context.Background())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, evaluated)
+	host := evaluate(t, 1)
+	assert.Equal(t, (*time.Time)(nil), host.LastEvaluation)
+	assert.Equal(t, 0, len(systemAdvisories(t, 1)))
+}
+
+func TestIsUpdate(t *testing.T) {
+	cases := []struct {
+		installed, update, arch string
+		res                     bool
+	}{
+		{"bash-4.2-1.x86_64", "bash-4.2-2.x86_64", "x86_64", true},
+		{"bash-4.2-2.x86_64", "bash-4.2-1.x86_64", "x86_64", false},
+		{"bash-4.2-1.x86_64", "bash-4.2-1.x86_64", "x86_64", false},
+		{"bash-4.2-1.x86_64", "bash-1:4.1-1.x86_64", "x86_64", true},
+		{"bash-4.2-1.x86_64", "bash-4.2-2.i686", "x86_64", false},
+		{"bash-4.2-1.x86_64", "bash-4.2-2.noarch", "x86_64", true},
+		{"bash-4.2-1.noarch", "bash-4.2-2.ppc64le", "x86_64", false},
+		{"bash-4.2-1.noarch", "bash-4.2-2.x86_64", "", true},
+	}
+	for _, c := range cases {
+		installed, err := utils.ParseNevra(c.installed)
+		assert.Equal(t, nil, err)
+		update, err := utils.ParseNevra(c.update)
+		assert.Equal(t, nil, err)
+		assert.Equalf(t, c.res, isUpdate(installed, update, c.arch), "%s -> %s", c.installed, c.update)
+	}
+}
@@ -0,0 +1,95 @@
+package evaluator
+
+import (
+	"app/base/database"
+	"app/base/utils"
+	"github.com/jinzhu/gorm"
+	"sort"
+)
+
+// evaluates against advisories synced into database by vmaas_sync, development fallback without VMaaS
+// synced errata don't list repositories, so updates from repositories not enabled on the system are reported too
+type localBackend struct{}
+
+// package fixed by advisory
+type advisoryPackage struct {
+	Advisory string
+	Name     string
+	Epoch    int
+	Version  string
+	Release  string
+	Arch     string
+}
+
+func (b *localBackend) Evaluate(tx *gorm.DB, profile *SystemProfile) (*Evaluation, error) {
+	var installed []*utils.Nevra
+	var names []string
+	seen := map[string]bool{}
+	for _, pkg := range profile.Packages {
+		nevra, err := utils.ParseNevra(pkg)
+		if err != nil {
+			utils.Log("nevra", pkg, "err", err.Error()).Warn("unable to parse package, skipping")
+			continue
+		}
+		installed = append(installed, nevra)
+		if !seen[nevra.Name] {
+			seen[nevra.Name] = true
+			names = append(names, nevra.Name)
+		}
+	}
+
+	candidates := map[string][]advisoryPackage{}
+	err := database.InChunks(len(names), func(start, end int) error {
+		var rows []advisoryPackage
+		err := tx.Table("advisory_package ap").
+			Select("am.name AS advisory, pn.name, p.epoch, p.version, p.release, p.arch").
+			Joins("JOIN advisory_metadata am ON am.id = ap.advisory_id").
+			Joins("JOIN package p ON p.id = ap.package_id").
+			Joins("JOIN package_name pn ON pn.id = p.name_id").
+			Where("pn.name IN (?)", names[start:end]).
+			Scan(&rows).Error
+		for _, row := range rows {
+			candidates[row.Name] = append(candidates[row.Name], row)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	evaluation := Evaluation{Updates: map[string]string{}}
+	advisories := map[string]bool{}
+	for _, pkg := range installed {
+		var latest *utils.Nevra
+		for _, candidate := range candidates[pkg.Name] {
+			update := utils.NewNevra(candidate.Name, candidate.Epoch, candidate.Version, candidate.Release, candidate.Arch)
+			if !isUpdate(pkg, update, profile.Arch) {
+				continue
+			}
+			advisories[candidate.Advisory] = true
+			if latest == nil || update.EVR().Compare(latest.EVR()) > 0 {
+				latest = update
+			}
+		}
+		if latest != nil {
+			evaluation.Updates[pkg.String()] = latest.String()
+		}
+	}
+
+	for name := range advisories {
+		evaluation.Advisories = append(evaluation.Advisories, name)
+	}
+	sort.Strings(evaluation.Advisories)
+	return &evaluation, nil
+}
+
+// newer version of installed package with the same arch, or noarch, installable on the system
+func isUpdate(installed, update *utils.Nevra, systemArch string) bool {
+	if update.Arch != installed.Arch && update.Arch != utils.NoArch && installed.Arch != utils.NoArch {
+		return false
+	}
+	if systemArch != "" && !utils.ArchCompatible(systemArch, update.Arch) {
+		return false
+	}
+	return update.EVR().Compare(installed.EVR()) > 0
+}
@@ -0,0 +1,55 @@
+package evaluator
+
+import (
+	"app/base/utils"
+	"app/base/vmaas"
+	"context"
+	"github.com/jinzhu/gorm"
+	"sort"
+)
+
+// evaluates using external updates service, advisories it reports have to be synced by vmaas_sync
+type remoteBackend struct {
+	client *vmaas.Client
+}
+
+func (b *remoteBackend) Evaluate(tx *gorm.DB, profile *SystemProfile) (*Evaluation, error) {
+	if len(profile.Packages) == 0 {
+		return &Evaluation{Updates: map[string]string{}}, nil
+	}
+	resp, err := b.client.Updates(context.Background(), &vmaas.UpdatesRequest{
+		PackageList:    profile.Packages,
+		RepositoryList: profile.Repos,
+		ModulesList:    profile.Modules,
+		Basearch:       profile.Arch,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	evaluation := Evaluation{Updates: map[string]string{}}
+	advisories := map[string]bool{}
+	for nevra, item := range resp.UpdateList {
+		var latest *utils.Nevra
+		for _, update := range item.AvailableUpdates {
+			advisories[update.Erratum] = true
+			parsed, err := utils.ParseNevra(update.Package)
+			if err != nil {
+				utils.Log("nevra", update.Package, "err", err.Error()).Warn("unable to parse update, skipping")
+				continue
+			}
+			if latest == nil || parsed.EVR().Compare(latest.EVR()) > 0 {
+				latest = parsed
+			}
+		}
+		if latest != nil {
+			evaluation.Updates[nevra] = latest.String()
+		}
+	}
+
+	for name := range advisories {
+		evaluation.Advisories = append(evaluation.Advisories, name)
+	}
+	sort.Strings(evaluation.Advisories)
+	return &evaluation, nil
+}
@@ -0,0 +1,74 @@
+package evaluator
+
+import (
+	"app/base/core"
+	"app/base/vmaas"
+	"context"
+	"github.com/bmizerany/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func setupRemote(t *testing.T) *vmaas.FakeServer {
+	server := vmaas.NewFakeServer(nil)
+	assert.Equal(t, nil, os.Setenv("EVALUATOR_BACKEND", "vmaas"))
+	assert.Equal(t, nil, os.Setenv("VMAAS_ADDRESS", server.URL))
+	Configure()
+	return server
+}
+
+func teardownRemote(server *vmaas.FakeServer) {
+	server.Close()
+	os.Unsetenv("EVALUATOR_BACKEND")
+	os.Unsetenv("VMAAS_ADDRESS")
+	backend = &localBackend{}
+}
+
+func TestEvaluateRemote(t *testing.T) {
+	core.SetupTestEnvironment()
+	server := setupRemote(t)
+	defer teardownRemote(server)
+	// advisories reported by the fake server
+	createAdvisory(t, "RHSA-2020:0001", "security")
+	createAdvisory(t, "RHBA-2020:0002", "bugfix")
+	createAdvisory(t, "RHSA-2020:0003", "security")
+	createSystem(t, 1, "x86_64")
+	installPackages(t, 1, "bash-4.2.46-34.el7.x86_64", "kernel-3.10.0-1062.el7.x86_64", "tzdata-2019c-1.el7.noarch")
+
+	host := evaluate(t, 1)
+	assert.Equal(t, 3, host.AdvisoryCountCache)
+	assert.Equal(t, 2, host.AdvisorySecCountCache)
+	assert.Equal(t, map[string]string{"bash": "0:4.2.46-35.el7_9.x86_64", "kernel": "0:3.10.0-1062.4.1.el7.x86_64"},
+		latestUpdates(t, 1))
+
+	requests := server.Requests()
+	assert.Equal(t, 1, len(requests))
+	assert.Equal(t, "x86_64", requests[0].Basearch)
+	assert.Equal(t, 3, len(requests[0].PackageList))
+}
+
+func TestEvaluateRemoteUnavailable(t *testing.T) {
+	core.SetupTestEnvironment()
+	server := setupRemote(t)
+	defer teardownRemote(server)
+	backend.(*remoteBackend).client = vmaas.NewClient(server.URL, vmaas.Config{Timeout: time.Second, MaxAttempts: 1})
+	createSystem(t, 1, "x86_64")
+	installPackages(t, 1, "bash-4.2.46-34.el7.x86_64")
+
+	server.FailNext(1)
+	_, failed, err := evaluateAll(context.Background())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, failed)
+}
+
+// enabled repositories are taken into account by default
+func TestConfigureDefault(t *testing.T) {
+	assert.Equal(t, nil, os.Setenv("VMAAS_ADDRESS", "http://vmaas:8080"))
+	defer os.Unsetenv("VMAAS_ADDRESS")
+	defer func() { backend = &localBackend{} }()
+
+	Configure()
+	_, ok := backend.(*remoteBackend)
+	assert.Equal(t, true, ok)
+}
@@ -0,0 +1,69 @@
+package evaluator
+
+import (
+	"app/base/database"
+	"app/base/structures"
+	"app/base/utils"
+	"context"
+	"github.com/jinzhu/gorm"
+	"strconv"
+	"time"
+)
+
+// evaluate all systems, each in its own transaction, return number of evaluated and failed systems
+// stops early when ctx is done
+func evaluateAll(ctx context.Context) (int, int, error) {
+	var ids []int
+	err := database.Db.Model(&structures.HostDAO{}).Where("opt_out = ?", false).Order("id").Pluck("id", &ids).Error
+	if err != nil {
+		return 0, 0, err
+	}
+
+	evaluated, failed := 0, 0
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			break
+		}
+		err = database.Transaction(func(tx *gorm.DB) error {
+			return EvaluateSystem(tx, id)
+		})
+		if err != nil {
+			utils.Log("systemID", id, "err", err.Error()).Error("unable to evaluate system")
+			failed++
+			continue
+		}
+		evaluated++
+	}
+	return evaluated, failed, nil
+}
+
+// re-evaluate all systems periodically, so they reflect newly synced advisories, until SIGTERM
+func RunEvaluator() {
+	utils.Log().Info("evaluator starting")
+	Configure()
+	interval, err := strconv.Atoi(utils.Getenv("EVALUATION_INTERVAL", "3600"))
+	if err != nil {
+		panic(err)
+	}
+
+	ctx, cancel := utils.SignalContext()
+	defer cancel()
+
+	for {
+		start := time.Now()
+		evaluated, failed, err := evaluateAll(ctx)
+		if err != nil {
+			utils.Log("err", err.Error()).Error("unable to evaluate systems")
+		} else {
+			utils.Log("evaluated", evaluated, "failed", failed, "duration", time.Since(start).Seconds()).
+				Info("systems evaluated")
+		}
+
+		select {
+		case <-ctx.Done():
+			utils.Log().Info("evaluator stopped")
+			return
+		case <-time.After(time.Duration(interval) * time.Second):
+		}
+	}
+}
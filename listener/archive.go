@@ -0,0 +1,201 @@
+package listener
+
+import (
+	"app/base/vmaas"
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// insights archive files we need, matched by file name prefix
+const (
+	rpmsFilePrefix     = "rpm_-qa"
+	unameFilePrefix    = "uname_-a"
+	repolistFilePrefix = "yum_-C_--noplugins_repolist"
+	// one file per module, e.g. etc/dnf/modules.d/nodejs.module, matched in path cleaned to start with /
+	modulesDir       = "/etc/dnf/modules.d/"
+	moduleFileSuffix = ".module"
+)
+
+// limit of decompressed archive, download size limit doesn't protect listener from highly compressed archives
+var maxUnpackedSize int64 = 500 * 1024 * 1024
+
+var errUnpackedTooBig = errors.New("unpacked archive too big")
+
+// reader failing when more than limit bytes are read
+type unpackLimitReader struct {
+	reader io.Reader
+	left   int64
+}
+
+func (r *unpackLimitReader) Read(p []byte) (int, error) {
+	if r.left <= 0 {
+		return 0, errUnpackedTooBig
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.reader.Read(p)
+	r.left -= int64(n)
+	return n, err
+}
+
+// read installed packages, arch, enabled repos and module streams from insights archive (.tar.gz)
+func parseArchive(archive []byte) (*Message, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var msg Message
+	// one more byte is allowed, so archive of exactly limit size is read to its end
+	reader := tar.NewReader(&unpackLimitReader{reader: gz, left: maxUnpackedSize + 1})
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if header.Size > maxUnpackedSize {
+			return nil, errUnpackedTooBig
+		}
+
+		name := path.Base(header.Name)
+		switch {
+		case strings.HasPrefix(name, rpmsFilePrefix):
+			packages, err := parseRpms(reader)
+			if err != nil {
+				return nil, err
+			}
+			msg.Packages = &packages
+		case strings.HasPrefix(name, unameFilePrefix):
+			content, err := ioutil.ReadAll(reader)
+			if err != nil {
+				return nil, err
+			}
+			msg.Arch = parseUnameArch(string(content))
+		case strings.HasPrefix(name, repolistFilePrefix):
+			repos, err := parseRepolist(reader)
+			if err != nil {
+				return nil, err
+			}
+			msg.Repos = &repos
+		case strings.Contains(path.Clean("/"+header.Name), modulesDir) && strings.HasSuffix(name, moduleFileSuffix):
+			modules, err := parseModules(reader)
+			if err != nil {
+				return nil, err
+			}
+			if msg.Modules == nil {
+				msg.Modules = &[]vmaas.Module{}
+			}
+			*msg.Modules = append(*msg.Modules, modules...)
+		}
+	}
+
+	if msg.Packages == nil {
+		return nil, errors.New("archive doesn't contain installed packages")
+	}
+	if msg.Arch == "" {
+		return nil, errors.New("archive doesn't contain system arch")
+	}
+	return &msg, nil
+}
+
+// first column of "rpm -qa" output is the package nevra
+func parseRpms(reader io.Reader) ([]string, error) {
+	packages := []string{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		packages = append(packages, fields[0])
+	}
+	return packages, scanner.Err()
+}
+
+// "uname -a" prints machine, processor, hardware platform and os as the last four fields
+func parseUnameArch(uname string) string {
+	fields := strings.Fields(uname)
+	if len(fields) < 4 {
+		return ""
+	}
+	return fields[len(fields)-4]
+}
+
+// take repo ids from "yum repolist" table, without arch/releasever suffix and enabled/expired flags
+func parseRepolist(reader io.Reader) ([]string, error) {
+	repos := []string{}
+	inTable := false
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "repo id"):
+			inTable = true
+			continue
+		case strings.HasPrefix(line, "repolist:"):
+			inTable = false
+			continue
+		}
+		fields := strings.Fields(line)
+		if !inTable || len(fields) == 0 {
+			continue
+		}
+		repo := strings.TrimLeft(fields[0], "!*")
+		repo = strings.SplitN(repo, "/", 2)[0]
+		repos = append(repos, repo)
+	}
+	return repos, scanner.Err()
+}
+
+// enabled streams from dnf module file, ini sections with name, stream and state keys
+func parseModules(reader io.Reader) ([]vmaas.Module, error) {
+	modules := []vmaas.Module{}
+	var module vmaas.Module
+	enabled := false
+	add := func() {
+		if enabled && module.Name != "" && module.Stream != "" {
+			modules = append(modules, module)
+		}
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			add()
+			module = vmaas.Module{Name: strings.Trim(line, "[]")}
+			enabled = false
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.TrimSpace(parts[0]) {
+		case "name":
+			module.Name = value
+		case "stream":
+			module.Stream = value
+		case "state":
+			enabled = value == "enabled"
+		}
+	}
+	add()
+	return modules, scanner.Err()
+}
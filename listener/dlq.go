@@ -0,0 +1,223 @@
+package listener
+
+import (
+	"app/base/utils"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// headers added to messages in dead-letter topic
+const (
+	dlqHeaderPrefix    = "dlq-"
+	dlqErrorHeader     = dlqHeaderPrefix + "error"
+	dlqTopicHeader     = dlqHeaderPrefix + "source-topic"
+	dlqPartitionHeader = dlqHeaderPrefix + "source-partition"
+	dlqOffsetHeader    = dlqHeaderPrefix + "source-offset"
+	dlqAttemptsHeader  = dlqHeaderPrefix + "attempts"
+)
+
+var (
+	// nil when dead-letter topic is not configured, failed messages are never committed then
+	dlqWriter messageWriter
+
+	// how many times is message processing tried before it's sent to dead-letter topic
+	maxProcessingAttempts = 3
+	// wait time before next attempt, multiplied by the attempt number
+	retryDelay = time.Second
+)
+
+// upper limit of the delay between attempts
+const maxRetryDelay = time.Minute
+
+var errDLQNotConfigured = errors.New("dead-letter topic not configured")
+
+// implemented by kafka.Writer
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// error which won't go away by retrying, message is sent to dead-letter topic right away
+type permanentError struct {
+	error
+}
+
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+func isPermanent(err error) bool {
+	_, ok := err.(permanentError)
+	return ok
+}
+
+// run fn until it succeeds, fails permanently or runs out of attempts
+// returns number of attempts and the last error
+func withRetries(fn func() error) (int, error) {
+	var err error
+	attempt := 0
+	for attempt < maxProcessingAttempts {
+		attempt++
+		err = fn()
+		if err == nil || isPermanent(err) {
+			break
+		}
+		if attempt < maxProcessingAttempts {
+			time.Sleep(retryBackoff(attempt))
+		}
+	}
+	return attempt, err
+}
+
+// delay after given number of failed attempts
+func retryBackoff(failures int) time.Duration {
+	delay := retryDelay * time.Duration(failures)
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// produce original message to dead-letter topic, with failure details in headers
+// the message must not be committed when this fails
+func deadLetter(ctx context.Context, m kafka.Message, reason error, attempts int) error {
+	if dlqWriter == nil {
+		return errDLQNotConfigured
+	}
+
+	headers := []kafka.Header{
+		{Key: dlqErrorHeader, Value: []byte(reason.Error())},
+		{Key: dlqTopicHeader, Value: []byte(m.Topic)},
+		{Key: dlqPartitionHeader, Value: []byte(strconv.Itoa(m.Partition))},
+		{Key: dlqOffsetHeader, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		{Key: dlqAttemptsHeader, Value: []byte(strconv.Itoa(attempts))},
+	}
+	dead := kafka.Message{Key: m.Key, Value: m.Value, Headers: append(originalHeaders(m.Headers), headers...)}
+	err := dlqWriter.WriteMessages(ctx, dead)
+	if err != nil {
+		return err
+	}
+	deadLettersCnt.WithLabelValues(m.Topic).Inc()
+	return nil
+}
+
+// send message to dead-letter topic, retry until it's written or ctx is done
+// blocks processing of the partition meanwhile, so no later offset is committed before it
+// returns the last error when ctx is done first, the message must not be committed then
+func deadLetterUntilWritten(ctx context.Context, m kafka.Message, reason error, attempts int) error {
+	for failures := 1; ; failures++ {
+		err := deadLetter(ctx, m, reason, attempts)
+		if err == nil {
+			return nil
+		}
+		utils.Log("topic", m.Topic, "partition", m.Partition, "offset", m.Offset, "failures", failures,
+			"err", err.Error()).Error("unable to write message to dead-letter topic, retrying")
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryBackoff(failures)):
+		}
+	}
+}
+
+// headers without the ones added by dead-letter handling
+func originalHeaders(headers []kafka.Header) []kafka.Header {
+	var res []kafka.Header
+	for _, header := range headers {
+		if !strings.HasPrefix(header.Key, dlqHeaderPrefix) {
+			res = append(res, header)
+		}
+	}
+	return res
+}
+
+func getHeader(headers []kafka.Header, key string) string {
+	for _, header := range headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// write messages from dead-letter topic back to their source topics
+// stops when there is no new message within idle timeout, returns number of replayed messages
+func replayDLQ(reader messageReader, writerFor func(topic string) messageWriter, idle time.Duration) int {
+	replayed := 0
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), idle)
+		m, err := reader.FetchMessage(ctx)
+		cancel()
+		if err == io.EOF || err == context.DeadlineExceeded {
+			return replayed
+		}
+		if err != nil {
+			utils.Log("err", err.Error()).Error("unable to read message from dead-letter topic")
+			return replayed
+		}
+
+		topic := getHeader(m.Headers, dlqTopicHeader)
+		if topic == "" {
+			utils.Log("offset", m.Offset).Error("message without source topic, skipping")
+		} else {
+			original := kafka.Message{Key: m.Key, Value: m.Value, Headers: originalHeaders(m.Headers)}
+			err = writerFor(topic).WriteMessages(context.Background(), original)
+			if err != nil {
+				utils.Log("err", err.Error(), "topic", topic).Error("unable to replay message")
+				return replayed
+			}
+			replayed++
+		}
+
+		err = reader.CommitMessages(context.Background(), m)
+		if err != nil {
+			utils.Log("err", err.Error()).Error("unable to commit replayed message")
+			return replayed
+		}
+	}
+}
+
+// admin command, replays whole dead-letter topic into processing
+func RunDLQReplay() {
+	dlqTopic := utils.GetenvOrFail("DLQ_TOPIC")
+	kafkaAddress := utils.GetenvOrFail("KAFKA_ADDRESS")
+	kafkaGroup := utils.GetenvOrFail("KAFKA_GROUP")
+	idle, err := strconv.Atoi(utils.Getenv("DLQ_REPLAY_IDLE_TIMEOUT", "10"))
+	if err != nil {
+		panic(err)
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  []string{kafkaAddress},
+		Topic:    dlqTopic,
+		GroupID:  kafkaGroup + "-dlq-replay",
+		MinBytes: 1,
+		MaxBytes: 10e6, // 1MB
+	})
+	writers := map[string]*kafka.Writer{}
+	writerFor := func(topic string) messageWriter {
+		if writers[topic] == nil {
+			writers[topic] = kafka.NewWriter(kafka.WriterConfig{Brokers: []string{kafkaAddress}, Topic: topic})
+		}
+		return writers[topic]
+	}
+
+	replayed := replayDLQ(reader, writerFor, time.Duration(idle)*time.Second)
+	utils.Log("replayed", replayed).Info("dead-letter topic replayed")
+
+	for _, writer := range writers {
+		err = writer.Close()
+		if err != nil {
+			utils.Log("err", err.Error()).Error("unable to close Kafka writer")
+		}
+	}
+	err = reader.Close()
+	if err != nil {
+		utils.Log("err", err.Error()).Error("unable to close Kafka reader")
+	}
+}
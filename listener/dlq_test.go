@@ -0,0 +1,276 @@
+package listener
+
+import (
+	"app/base/core"
+	"app/base/database"
+	"app/base/structures"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/bmizerany/assert"
+	"github.com/segmentio/kafka-go"
+	"testing"
+	"time"
+)
+
+type testWriter struct {
+	written []kafka.Message
+	// number of writes which fail before the first successful one
+	failures int
+}
+
+func (w *testWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.failures > 0 {
+		w.failures--
+		return errors.New("write failed")
+	}
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+// dead-letter topic writer used by the test, processing is not delayed
+func setupDLQ(attempts int) *testWriter {
+	writer := &testWriter{}
+	dlqWriter = writer
+	maxProcessingAttempts = attempts
+	retryDelay = 0
+	return writer
+}
+
+func TestWithRetries(t *testing.T) {
+	setupDLQ(3)
+	calls := 0
+	attempts, err := withRetries(func() error {
+		calls++
+		return errors.New("transient")
+	})
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, "transient", err.Error())
+
+	calls = 0
+	attempts, err = withRetries(func() error {
+		calls++
+		return permanent(errors.New("permanent"))
+	})
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, true, isPermanent(err))
+}
+
+func TestDeadLetterHeaders(t *testing.T) {
+	writer := setupDLQ(3)
+	err := deadLetter(context.Background(), kafka.Message{Topic: "platform.upload.available", Partition: 2, Offset: 42, Key: []byte("k"),
+		Value: []byte("v"), Headers: []kafka.Header{{Key: "origin", Value: []byte("test")}}},
+		errors.New("broken"), 3)
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, 1, len(writer.written))
+	m := writer.written[0]
+	assert.Equal(t, "k", string(m.Key))
+	assert.Equal(t, "v", string(m.Value))
+	assert.Equal(t, "test", getHeader(m.Headers, "origin"))
+	assert.Equal(t, "broken", getHeader(m.Headers, dlqErrorHeader))
+	assert.Equal(t, "platform.upload.available", getHeader(m.Headers, dlqTopicHeader))
+	assert.Equal(t, "2", getHeader(m.Headers, dlqPartitionHeader))
+	assert.Equal(t, "42", getHeader(m.Headers, dlqOffsetHeader))
+	assert.Equal(t, "3", getHeader(m.Headers, dlqAttemptsHeader))
+}
+
+func TestDeadLetterNotConfigured(t *testing.T) {
+	setupDLQ(3)
+	dlqWriter = nil
+	defer setupDLQ(3)
+
+	err := deadLetter(context.Background(), kafka.Message{}, errors.New("broken"), 1)
+	assert.Equal(t, errDLQNotConfigured, err)
+}
+
+func TestDeadLetterInvalidUpload(t *testing.T) {
+	writer := setupDLQ(3)
+	storage = InitStorage(10, false)
+
+	uploadHandler(context.Background(), kafka.Message{Topic: "platform.upload.available", Value: []byte("not a json")})
+	assert.Equal(t, 1, len(writer.written))
+	assert.Equal(t, "1", getHeader(writer.written[0].Headers, dlqAttemptsHeader))
+	// still committed with the next flush
+	assert.Equal(t, 1, storage.PendingMessages())
+}
+
+func TestDeadLetterUnavailableArchive(t *testing.T) {
+	writer := setupDLQ(2)
+	storage = InitStorage(10, false)
+	// nothing listens there
+	source, _ = newArchiveSource("http://127.0.0.1:1", time.Second)
+
+	uploadHandler(context.Background(), kafka.Message{Value: []byte(`{"id": "` + testInventoryID + `", "account": "0000001", "url": "http://s3/archive"}`)})
+	assert.Equal(t, 1, len(writer.written))
+	assert.Equal(t, "2", getHeader(writer.written[0].Headers, dlqAttemptsHeader))
+}
+
+func TestDeadLetterInvalidEvent(t *testing.T) {
+	core.SetupTestEnvironment()
+	writer := setupDLQ(3)
+
+	assert.Equal(t, true, eventsHandler(context.Background(), kafka.Message{Value: []byte(`{"type": "unknown"}`)}))
+	assert.Equal(t, true, eventsHandler(context.Background(), kafka.Message{Value: []byte(`{"type": `)}))
+	assert.Equal(t, 2, len(writer.written))
+	assert.Equal(t, "unknown event type 'unknown'", getHeader(writer.written[0].Headers, dlqErrorHeader))
+}
+
+func TestDeadLetterStorage(t *testing.T) {
+	core.SetupTestEnvironment()
+	writer := setupDLQ(2)
+	committer := &testCommitter{}
+	storage := InitStorage(2, false)
+	storage.committer = committer
+
+	// rejected host can't be written
+	err := database.Db.Exec(`CREATE TRIGGER reject_host BEFORE INSERT ON hosts
+		WHEN NEW.inventory_id = 'INV-BAD' BEGIN SELECT RAISE(ABORT, 'rejected'); END`).Error
+	assert.Equal(t, nil, err)
+
+	err = storage.Add(&structures.HostDAO{InventoryID: "INV-BAD"}, kafka.Message{Offset: 1})
+	assert.Equal(t, nil, err)
+	err = storage.Add(&structures.HostDAO{InventoryID: "INV-2"}, kafka.Message{Offset: 2})
+	assert.NotEqual(t, nil, err)
+	// valid host written, rejected one kept for the next attempt, nothing committed
+	assert.Equal(t, 0, len(writer.written))
+	assert.Equal(t, 1, storage.StoredItems())
+	assert.Equal(t, 0, len(committer.committed))
+	cnt, _ := database.HostsCount()
+	assert.Equal(t, 1, cnt)
+
+	// second failed attempt of the host, sent to dead-letter topic
+	err = storage.Flush()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(writer.written))
+	assert.Equal(t, "1", getHeader(writer.written[0].Headers, dlqOffsetHeader))
+	assert.Equal(t, "2", getHeader(writer.written[0].Headers, dlqAttemptsHeader))
+	assert.Equal(t, 2, len(committer.committed))
+	assert.Equal(t, 0, storage.StoredItems())
+}
+
+func TestStorageTransientError(t *testing.T) {
+	core.SetupTestEnvironment()
+	writer := setupDLQ(1)
+	committer := &testCommitter{}
+	storage := InitStorage(10, true)
+	storage.committer = committer
+
+	// another connection holds the write lock, writes fail with "database is locked"
+	var file string
+	var seq int
+	var name string
+	err := database.Db.DB().QueryRow("PRAGMA database_list").Scan(&seq, &name, &file)
+	assert.Equal(t, nil, err)
+	other, err := sql.Open("sqlite3", file)
+	assert.Equal(t, nil, err)
+	defer other.Close()
+	tx, err := other.Begin()
+	assert.Equal(t, nil, err)
+	_, err = tx.Exec("INSERT INTO hosts (inventory_id, request, checksum) VALUES ('INV-LOCK', '', '')")
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-1"}, kafka.Message{Offset: 1}))
+	err = storage.Flush()
+	assert.Equal(t, true, database.IsTransient(err))
+	assert.Equal(t, true, database.IsTransient(storage.Flush()))
+	// kept without counting attempts, nothing dead-lettered or committed
+	assert.Equal(t, 1, storage.StoredItems())
+	assert.Equal(t, 0, len(writer.written))
+	assert.Equal(t, 0, len(committer.committed))
+
+	assert.Equal(t, nil, tx.Rollback())
+	assert.Equal(t, nil, storage.Flush())
+	assert.Equal(t, 0, storage.StoredItems())
+	assert.Equal(t, 1, len(committer.committed))
+	cnt, _ := database.HostsCount()
+	assert.Equal(t, 1, cnt)
+}
+
+func TestDeadLetterEventWriteFailed(t *testing.T) {
+	core.SetupTestEnvironment()
+	writer := setupDLQ(3)
+	writer.failures = 2
+
+	// retried until written, only then committed
+	assert.Equal(t, true, eventsHandler(context.Background(), kafka.Message{Value: []byte(`{"type": "unknown"}`)}))
+	assert.Equal(t, 0, writer.failures)
+	assert.Equal(t, 1, len(writer.written))
+}
+
+func TestDeadLetterStopped(t *testing.T) {
+	core.SetupTestEnvironment()
+	writer := setupDLQ(1)
+	writer.failures = 1000
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// listener is stopping, message is neither dead-lettered nor committed
+	assert.Equal(t, false, eventsHandler(ctx, kafka.Message{Value: []byte(`{"type": "unknown"}`)}))
+	storage = InitStorage(10, false)
+	assert.Equal(t, false, uploadHandler(ctx, kafka.Message{Value: []byte("not a json")}))
+	assert.Equal(t, 0, len(writer.written))
+	assert.Equal(t, 0, storage.PendingMessages())
+}
+
+func TestDeadLetterStorageWriteFailed(t *testing.T) {
+	core.SetupTestEnvironment()
+	writer := setupDLQ(1)
+	writer.failures = 1
+	committer := &testCommitter{}
+	storage := InitStorage(10, false)
+	storage.committer = committer
+
+	err := database.Db.Exec(`CREATE TRIGGER reject_host BEFORE INSERT ON hosts
+		BEGIN SELECT RAISE(ABORT, 'rejected'); END`).Error
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-BAD"}, kafka.Message{Offset: 1}))
+	// not dead-lettered, kept uncommitted
+	assert.NotEqual(t, nil, storage.Flush())
+	assert.Equal(t, 1, storage.StoredItems())
+	assert.Equal(t, 0, len(committer.committed))
+
+	assert.Equal(t, nil, storage.Flush())
+	assert.Equal(t, 1, len(writer.written))
+	assert.Equal(t, 0, storage.StoredItems())
+	assert.Equal(t, 1, len(committer.committed))
+}
+
+type dlqTestReader struct {
+	testCommitter
+	messages []kafka.Message
+}
+
+func (r *dlqTestReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(r.messages) == 0 {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	m := r.messages[0]
+	r.messages = r.messages[1:]
+	return m, nil
+}
+
+func TestReplayDLQ(t *testing.T) {
+	reader := &dlqTestReader{messages: []kafka.Message{
+		{Value: []byte("upload"), Headers: []kafka.Header{{Key: dlqTopicHeader, Value: []byte("uploads")},
+			{Key: dlqErrorHeader, Value: []byte("err")}, {Key: "origin", Value: []byte("test")}}},
+		{Value: []byte("no source")},
+		{Value: []byte("event"), Headers: []kafka.Header{{Key: dlqTopicHeader, Value: []byte("events")}}},
+	}}
+	writers := map[string]*testWriter{"uploads": {}, "events": {}}
+
+	replayed := replayDLQ(reader, func(topic string) messageWriter {
+		return writers[topic]
+	}, time.Millisecond)
+
+	assert.Equal(t, 2, replayed)
+	assert.Equal(t, 3, len(reader.committed))
+	assert.Equal(t, 1, len(writers["uploads"].written))
+	assert.Equal(t, "upload", string(writers["uploads"].written[0].Value))
+	assert.Equal(t, []kafka.Header{{Key: "origin", Value: []byte("test")}}, writers["uploads"].written[0].Headers)
+	assert.Equal(t, "event", string(writers["events"].written[0].Value))
+}
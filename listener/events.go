@@ -0,0 +1,123 @@
+package listener
+
+import (
+	"app/base/database"
+	"app/base/structures"
+	"app/base/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+const (
+	createdEvent = "created"
+	updatedEvent = "updated"
+	deleteEvent  = "delete"
+)
+
+// platform.inventory.events message, host is set for created and updated events only
+type InventoryEvent struct {
+	Type      string     `json:"type"`
+	ID        string     `json:"id"`
+	Account   string     `json:"account"`
+	Timestamp string     `json:"timestamp"`
+	Host      *EventHost `json:"host"`
+}
+
+type EventHost struct {
+	ID                    string     `json:"id"`
+	Account               string     `json:"account"`
+	DisplayName           string     `json:"display_name"`
+	Tags                  []EventTag `json:"tags"`
+	StaleTimestamp        *time.Time `json:"stale_timestamp"`
+	StaleWarningTimestamp *time.Time `json:"stale_warning_timestamp"`
+	CulledTimestamp       *time.Time `json:"culled_timestamp"`
+}
+
+type EventTag struct {
+	Namespace *string `json:"namespace"`
+	Key       string  `json:"key"`
+	Value     *string `json:"value"`
+}
+
+// events are written right away, so they can be committed immediately
+// events which can't be processed go to dead-letter topic, committed only once they are written there
+func eventsHandler(ctx context.Context, m kafka.Message) bool {
+	var event InventoryEvent
+	err := json.Unmarshal(m.Value, &event)
+	if err != nil {
+		utils.Log("err", err.Error()).Error("unable to parse inventory event")
+		return deadLetterUntilWritten(ctx, m, err, 1) == nil
+	}
+
+	attempts, err := withRetries(func() error {
+		return processEvent(&event)
+	})
+	if err != nil {
+		eventsCnt.WithLabelValues(event.Type, resultError).Inc()
+		utils.Log("type", event.Type, "attempts", attempts, "err", err.Error()).
+			Error("unable to process inventory event")
+		return deadLetterUntilWritten(ctx, m, err, attempts) == nil
+	}
+	eventsCnt.WithLabelValues(event.Type, resultSuccess).Inc()
+	return true
+}
+
+func processEvent(event *InventoryEvent) error {
+	switch event.Type {
+	case createdEvent, updatedEvent:
+		if event.Host == nil || event.Host.ID == "" {
+			return permanent(errors.New("missing host"))
+		}
+		return upsertHost(event.Host)
+	case deleteEvent:
+		if event.ID == "" {
+			return permanent(errors.New("missing host id"))
+		}
+		return storage.Delete(event.ID)
+	default:
+		return permanent(fmt.Errorf("unknown event type '%s'", event.Type))
+	}
+}
+
+// create host or update its inventory data, keep uploaded profile untouched
+func upsertHost(eventHost *EventHost) error {
+	tags, err := json.Marshal(eventHost.Tags)
+	if err != nil {
+		return err
+	}
+
+	inventory := map[string]interface{}{
+		"account":                 eventHost.Account,
+		"display_name":            eventHost.DisplayName,
+		"tags":                    string(tags),
+		"stale_timestamp":         eventHost.StaleTimestamp,
+		"stale_warning_timestamp": eventHost.StaleWarningTimestamp,
+		"culled_timestamp":        eventHost.CulledTimestamp,
+	}
+
+	return database.Transaction(func(tx *gorm.DB) error {
+		var host structures.HostDAO
+		err := tx.Where("inventory_id = ?", eventHost.ID).First(&host).Error
+		if gorm.IsRecordNotFoundError(err) {
+			host = structures.HostDAO{InventoryID: eventHost.ID}
+			err = tx.Create(&host).Error
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&host).Updates(inventory).Error
+	})
+}
+
+// delete host together with all its data in single transaction
+func deleteHost(inventoryID string) error {
+	return database.Transaction(func(tx *gorm.DB) error {
+		_, err := database.DeleteSystem(tx, inventoryID)
+		return err
+	})
+}
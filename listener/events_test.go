@@ -0,0 +1,113 @@
+package listener
+
+import (
+	"app/base/core"
+	"app/base/database"
+	"app/base/structures"
+	"context"
+	"fmt"
+	"github.com/bmizerany/assert"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"testing"
+	"time"
+)
+
+const testHostEvent = `{"type": "%s", "host": {"id": "` + testInventoryID + `", "account": "0000001",
+	"display_name": "%s", "tags": [{"namespace": "insights-client", "key": "env", "value": "prod"}],
+	"stale_timestamp": "2019-11-20T12:00:00+00:00", "stale_warning_timestamp": "2019-11-27T12:00:00+00:00",
+	"culled_timestamp": "2019-12-04T12:00:00+00:00"}}`
+
+func sendEvent(event string, args ...interface{}) {
+	eventsHandler(context.Background(), kafka.Message{Value: []byte(fmt.Sprintf(event, args...))})
+}
+
+func getTestHost(t *testing.T) structures.HostDAO {
+	var host structures.HostDAO
+	err := database.Db.Where("inventory_id = ?", testInventoryID).First(&host).Error
+	assert.Equal(t, nil, err)
+	return host
+}
+
+func TestEventCreated(t *testing.T) {
+	core.SetupTestEnvironment()
+	before := testutil.ToFloat64(eventsCnt.WithLabelValues(createdEvent, resultSuccess))
+
+	sendEvent(testHostEvent, createdEvent, "host1")
+
+	host := getTestHost(t)
+	assert.Equal(t, "0000001", host.Account)
+	assert.Equal(t, "host1", host.DisplayName)
+	assert.Equal(t, `[{"namespace":"insights-client","key":"env","value":"prod"}]`, host.Tags)
+	assert.Equal(t, "2019-11-20T12:00:00Z", host.StaleTimestamp.UTC().Format(time.RFC3339))
+	assert.Equal(t, "2019-11-27T12:00:00Z", host.StaleWarningTimestamp.UTC().Format(time.RFC3339))
+	assert.Equal(t, "2019-12-04T12:00:00Z", host.CulledTimestamp.UTC().Format(time.RFC3339))
+	assert.Equal(t, before+1, testutil.ToFloat64(eventsCnt.WithLabelValues(createdEvent, resultSuccess)))
+}
+
+func TestEventUpdated(t *testing.T) {
+	core.SetupTestEnvironment()
+	err := database.Db.Create(&structures.HostDAO{InventoryID: testInventoryID, Request: "r", Checksum: "c",
+		DisplayName: "old"}).Error
+	assert.Equal(t, nil, err)
+	before := testutil.ToFloat64(eventsCnt.WithLabelValues(updatedEvent, resultSuccess))
+
+	sendEvent(testHostEvent, updatedEvent, "new")
+
+	host := getTestHost(t)
+	assert.Equal(t, "new", host.DisplayName)
+	assert.Equal(t, "0000001", host.Account)
+	// uploaded profile is kept
+	assert.Equal(t, "r", host.Request)
+	assert.Equal(t, "c", host.Checksum)
+	assert.Equal(t, before+1, testutil.ToFloat64(eventsCnt.WithLabelValues(updatedEvent, resultSuccess)))
+}
+
+func TestEventDelete(t *testing.T) {
+	core.SetupTestEnvironment()
+	storage = InitStorage(10, false)
+	sendEvent(testHostEvent, createdEvent, "host1")
+	before := testutil.ToFloat64(eventsCnt.WithLabelValues(deleteEvent, resultSuccess))
+
+	sendEvent(`{"type": "delete", "id": "%s", "account": "0000001"}`, testInventoryID)
+
+	cnt, err := database.HostsCount()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, cnt)
+	assert.Equal(t, before+1, testutil.ToFloat64(eventsCnt.WithLabelValues(deleteEvent, resultSuccess)))
+}
+
+// buffered upload of deleted host is not written by next flush
+func TestEventDeleteBuffered(t *testing.T) {
+	core.SetupTestEnvironment()
+	storage = InitStorage(10, false)
+	sendEvent(testHostEvent, createdEvent, "host1")
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: testInventoryID, Account: "0000001"},
+		kafka.Message{Offset: 1}))
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-2"}, kafka.Message{Offset: 2}))
+
+	sendEvent(`{"type": "delete", "id": "%s", "account": "0000001"}`, testInventoryID)
+	assert.Equal(t, 1, storage.StoredItems())
+	assert.Equal(t, nil, storage.Flush())
+
+	var hosts []structures.HostDAO
+	assert.Equal(t, nil, database.Db.Find(&hosts).Error)
+	assert.Equal(t, 1, len(hosts))
+	assert.Equal(t, "INV-2", hosts[0].InventoryID)
+	assert.Equal(t, 0, storage.PendingMessages())
+}
+
+func TestEventInvalid(t *testing.T) {
+	core.SetupTestEnvironment()
+	beforeUnknown := testutil.ToFloat64(eventsCnt.WithLabelValues("unknown", resultError))
+	beforeCreated := testutil.ToFloat64(eventsCnt.WithLabelValues(createdEvent, resultError))
+
+	sendEvent(`{"type": "unknown"}`)
+	sendEvent(`{"type": "created"}`)
+
+	cnt, err := database.HostsCount()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, cnt)
+	assert.Equal(t, beforeUnknown+1, testutil.ToFloat64(eventsCnt.WithLabelValues("unknown", resultError)))
+	assert.Equal(t, beforeCreated+1, testutil.ToFloat64(eventsCnt.WithLabelValues(createdEvent, resultError)))
+}
@@ -2,7 +2,15 @@ package listener
 
 import (
 	"app/base/utils"
+	"app/evaluator"
 	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
 	"github.com/gin-gonic/gin"
 	"github.com/segmentio/kafka-go"
 	ginprometheus "github.com/zsais/go-gin-prometheus"
@@ -11,8 +19,26 @@ import (
 var (
 	uploadReader *kafka.Reader
 	eventsReader *kafka.Reader
+	storage      *Storage
+	source       *archiveSource
+	// buffered hosts are written at latest after this time
+	storageMaxLatency time.Duration
+
+	// wait times between failed reads from kafka
+	minReadBackoff = time.Second
+	maxReadBackoff = time.Minute
 )
 
+// implemented by kafka.Reader
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	messageCommitter
+}
+
+// process message, return true when the message can be committed right away,
+// false when its commit is left to the storage or the message must not be committed
+type messageHandler func(ctx context.Context, m kafka.Message) bool
+
 func configure() {
 	uploadTopic := utils.GetenvOrFail("UPLOAD_TOPIC")
 	eventsTopic := utils.GetenvOrFail("EVENTS_TOPIC")
@@ -22,6 +48,9 @@ func configure() {
 
 	utils.Log("KafkaAddress", kafkaAddress).Info("Connecting to kafka")
 
+	// uploaded hosts are evaluated when written
+	evaluator.Configure()
+
 	uploadConfig := kafka.ReaderConfig{
 		Brokers:        []string{kafkaAddress},
 		Topic:          uploadTopic,
@@ -37,6 +66,40 @@ func configure() {
 
 	eventsReader = kafka.NewReader(eventsConfig)
 
+	bufferSize, err := strconv.Atoi(utils.Getenv("STORAGE_BUFFER_SIZE", "100"))
+	if err != nil {
+		panic(err)
+	}
+	// batch upsert works with both, host per statement is enough for SQLite used in development
+	storage = InitStorage(bufferSize, os.Getenv("DB_TYPE") == "postgres")
+	storage.committer = uploadReader
+
+	maxLatency, err := strconv.Atoi(utils.Getenv("STORAGE_MAX_LATENCY", "5"))
+	if err != nil {
+		panic(err)
+	}
+	// flusher ticker needs positive interval
+	if maxLatency <= 0 {
+		panic(fmt.Sprintf("STORAGE_MAX_LATENCY must be positive number of seconds, got %d", maxLatency))
+	}
+	storageMaxLatency = time.Duration(maxLatency) * time.Second
+
+	downloadTimeout, err := strconv.Atoi(utils.Getenv("UPLOAD_DOWNLOAD_TIMEOUT", "60"))
+	if err != nil {
+		panic(err)
+	}
+	source, err = newArchiveSource(os.Getenv("UPLOAD_SOURCE_URL"), time.Duration(downloadTimeout)*time.Second)
+	if err != nil {
+		panic(err)
+	}
+
+	maxProcessingAttempts, err = strconv.Atoi(utils.Getenv("MAX_PROCESSING_ATTEMPTS", "3"))
+	if err != nil {
+		panic(err)
+	}
+	// messages which can't be processed are never committed without dead-letter topic
+	dlqTopic := utils.GetenvOrFail("DLQ_TOPIC")
+	dlqWriter = kafka.NewWriter(kafka.WriterConfig{Brokers: []string{kafkaAddress}, Topic: dlqTopic})
 }
 
 func shutdown() {
@@ -48,52 +111,124 @@ func shutdown() {
 	if err != nil {
 		utils.Log("err", err.Error()).Error("unable to shutdown Kafka reader")
 	}
+	if writer, ok := dlqWriter.(*kafka.Writer); ok {
+		err = writer.Close()
+		if err != nil {
+			utils.Log("err", err.Error()).Error("unable to shutdown Kafka writer")
+		}
+	}
 
 }
 
-func baseListener(reader *kafka.Reader, handler func(message kafka.Message)) {
+// fetch messages until ctx is done or the reader is closed,
+// offsets are committed only after the message is processed
+func baseListener(ctx context.Context, reader messageReader, handler messageHandler) {
+	backoff := minReadBackoff
 	for {
-		m, err := reader.ReadMessage(context.Background())
+		m, err := reader.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == io.EOF {
+			utils.Log().Info("Kafka reader closed")
+			return
+		}
 		if err != nil {
-			utils.Log("err", err.Error()).Error("unable to read message from Kafka reader")
-			panic(err)
-
+			utils.Log("err", err.Error(), "backoff", backoff.String()).
+				Error("unable to read message from Kafka reader, retrying")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxReadBackoff {
+				backoff = maxReadBackoff
+			}
+			continue
+		}
+		backoff = minReadBackoff
+
+		if handler(ctx, m) {
+			err = reader.CommitMessages(context.Background(), m)
+			if err != nil {
+				utils.Log("err", err.Error(), "topic", m.Topic, "offset", m.Offset).
+					Error("unable to commit message")
+			}
 		}
-		handler(m)
-
 	}
 }
 
-func logHandler(m kafka.Message) {
-	utils.Log().Info("Received message [", m.Topic,"] ", string(m.Value))
-}
-
-func runMetrics() {
+func runMetrics(ctx context.Context) {
 	// create web app
 	app := gin.New()
 
 	prometheus := ginprometheus.NewPrometheus("gin")
 	prometheus.Use(app)
-	err := app.Run(":8081")
-	if err != nil {
-		utils.Log("err", err.Error()).Error()
-		panic(err)
+	err := utils.RunServer(ctx, &http.Server{Addr: ":8081", Handler: app}, utils.GetShutdownTimeout())
+	utils.LogServerError("metrics", err)
+}
+
+// wait for in-flight messages, write buffered hosts and commit their offsets, all within timeout
+// hosts not written in time are left uncommitted and will be delivered again
+func drain(listeners *sync.WaitGroup, timeout time.Duration) {
+	deadline := time.After(timeout)
+	done := make(chan struct{})
+	go func() {
+		listeners.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-deadline:
+		utils.Log("timeout", timeout.String()).Warn("in-flight messages not finished, skipping flush")
+		return
+	}
+
+	flushed := make(chan error, 1)
+	go func() {
+		flushed <- storage.Flush()
+	}()
+
+	select {
+	case err := <-flushed:
+		if err != nil {
+			utils.Log("err", err.Error()).Error("unable to flush storage on shutdown")
+		}
+	case <-deadline:
+		utils.Log("timeout", timeout.String()).Warn("storage not flushed in time")
 	}
 }
 
 func RunListener() {
 	utils.Log().Info("listener starting")
 
+	ctx, cancel := utils.SignalContext()
+	defer cancel()
+
 	// Start a web server for handling metrics so that readiness probe works
-	go runMetrics()
+	go runMetrics(ctx)
 
 	configure()
 	defer shutdown()
 
-	go baseListener(uploadReader, logHandler)
-	go baseListener(eventsReader, logHandler)
-
-	// Just block. Any error will panic and kill the process.
-	<- make(chan bool)
-
+	go storage.RunFlusher(ctx, storageMaxLatency)
+	go storage.RunEvaluator(ctx)
+
+	var listeners sync.WaitGroup
+	listeners.Add(2)
+	go func() {
+		defer listeners.Done()
+		baseListener(ctx, uploadReader, uploadHandler)
+	}()
+	go func() {
+		defer listeners.Done()
+		baseListener(ctx, eventsReader, eventsHandler)
+	}()
+
+	<-ctx.Done()
+	utils.Log().Info("listener stopping")
+	drain(&listeners, utils.GetShutdownTimeout())
+	utils.Log().Info("listener stopped")
 }
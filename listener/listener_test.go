@@ -0,0 +1,99 @@
+package listener
+
+import (
+	"app/base/core"
+	"app/base/database"
+	"app/base/structures"
+	"context"
+	"errors"
+	"github.com/bmizerany/assert"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// returns queued results, io.EOF when there is nothing left
+type testReader struct {
+	testCommitter
+	results []error
+	fetched int64
+}
+
+func (r *testReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(r.results) == 0 {
+		return kafka.Message{}, io.EOF
+	}
+	err := r.results[0]
+	r.results = r.results[1:]
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	r.fetched++
+	return kafka.Message{Offset: r.fetched}, nil
+}
+
+func TestBaseListenerRetryAndCommit(t *testing.T) {
+	minReadBackoff, maxReadBackoff = time.Millisecond, 2*time.Millisecond
+	readErr := errors.New("connection reset")
+	reader := &testReader{results: []error{nil, readErr, readErr, readErr, nil, nil}}
+
+	var handled []int64
+	baseListener(context.Background(), reader, func(ctx context.Context, m kafka.Message) bool {
+		handled = append(handled, m.Offset)
+		// commit odd messages right away
+		return m.Offset%2 == 1
+	})
+
+	assert.Equal(t, []int64{1, 2, 3}, handled)
+	assert.Equal(t, 2, len(reader.committed))
+	assert.Equal(t, int64(1), reader.committed[0].Offset)
+	assert.Equal(t, int64(3), reader.committed[1].Offset)
+}
+
+func TestBaseListenerCancel(t *testing.T) {
+	minReadBackoff, maxReadBackoff = time.Hour, time.Hour
+	reader := &testReader{results: []error{errors.New("connection reset")}}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stopped := make(chan bool)
+	go func() {
+		baseListener(ctx, reader, func(ctx context.Context, m kafka.Message) bool { return true })
+		stopped <- true
+	}()
+	// listener waits for the next read attempt, cancel interrupts it
+	cancel()
+	assert.Equal(t, true, <-stopped)
+}
+
+func TestDrainFlushesStorage(t *testing.T) {
+	core.SetupTestEnvironment()
+	committer := &testCommitter{}
+	storage = InitStorage(10, false)
+	storage.committer = committer
+	err := storage.Add(&structures.HostDAO{InventoryID: "INV-1"}, kafka.Message{Offset: 1})
+	assert.Equal(t, nil, err)
+
+	var listeners sync.WaitGroup
+	drain(&listeners, time.Second)
+
+	cnt, _ := database.HostsCount()
+	assert.Equal(t, 1, cnt)
+	assert.Equal(t, 1, len(committer.committed))
+}
+
+func TestDrainTimeout(t *testing.T) {
+	committer := &testCommitter{}
+	storage = InitStorage(10, false)
+	storage.committer = committer
+	err := storage.Add(nil, kafka.Message{Offset: 1})
+	assert.Equal(t, nil, err)
+
+	// listener never finishes, nothing is committed
+	var listeners sync.WaitGroup
+	listeners.Add(1)
+	drain(&listeners, 10*time.Millisecond)
+	assert.Equal(t, 0, len(committer.committed))
+	assert.Equal(t, 1, storage.PendingMessages())
+}
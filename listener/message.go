@@ -5,53 +5,53 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"app/base/utils"
+	"app/base/vmaas"
+	"fmt"
 )
 
 type Message struct {
 	ID              int        `json:"id"`
 	Arch            string     `json:"arch"`
 	Packages        *[]string  `json:"packages"`
+	Repos           *[]string  `json:"repos,omitempty"`
+	// enabled module streams
+	Modules         *[]vmaas.Module `json:"modules,omitempty"`
 }
 
-func (msg *Message) FilterPackages() {
-	// filter packages in parallel using go-routines
-	nPkgs := len(*msg.Packages)
-	channel := make(chan int, nPkgs)
-	for i, pkg := range *msg.Packages {
-		filterNevra(i, pkg, msg.Arch, channel)
-	}
-
-	// create mask of filtered packages
-	packagesMask := make([]int, nPkgs)
-	for i := 0; i < nPkgs; i++ {
-		index, _ := <- channel
-		if index != -1 {
-			packagesMask[index] = 1
-		}
-	}
+// package removed from message by FilterPackages
+type FilteredPackage struct {
+	Package string
+	Reason  string
+}
 
-	// select packages according to mask
-	filteredPackages := make([]string, 0, nPkgs)
-	for i, pkgMask := range packagesMask {
-		if pkgMask == 1 {
-			filteredPackages = append(filteredPackages, (*msg.Packages)[i])
+// keep only packages installable on system arch, return removed packages with the reason
+func (msg *Message) FilterPackages() []FilteredPackage {
+	filteredPackages := make([]string, 0, len(*msg.Packages))
+	var removed []FilteredPackage
+	for _, pkg := range *msg.Packages {
+		reason := filterNevra(pkg, msg.Arch)
+		if reason != "" {
+			utils.Log("nevra", pkg, "arch", msg.Arch, "reason", reason).Debug("package filtered out")
+			removed = append(removed, FilteredPackage{Package: pkg, Reason: reason})
+			continue
 		}
+		filteredPackages = append(filteredPackages, pkg)
 	}
 	msg.Packages = &filteredPackages
+	return removed
 }
 
-// parse nevra and check arch, send index to channel, or -1 to remove
-func filterNevra(index int, pkg, arch string, channel chan int) {
+// parse nevra and check arch, return reason why package should be removed or empty string to keep it
+func filterNevra(pkg, arch string) string {
 	nevra, err := utils.ParseNevra(pkg)
 	if err != nil {
-		utils.Log("err", err.Error(), "nevra", pkg).Error("unable to parse nevra")
+		return err.Error()
 	}
 
-	if nevra.Arch == arch {
-		channel <- index
-	} else {
-		channel <- -1
+	if !utils.ArchCompatible(arch, nevra.Arch) {
+		return fmt.Sprintf("arch %s not compatible with system arch %s", nevra.Arch, arch)
 	}
+	return ""
 }
 
 func (msg *Message) ToJSON() []byte {
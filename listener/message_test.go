@@ -13,11 +13,44 @@ func TestFilter(t *testing.T)  {
 			"lohit-oriya-fonts-2.4.3-6.el6.noarch",
 			"bzip2-debuginfo-1.0.3-4.el5_2.i386",
 			"upstart-0.6.5-6.1.el6_0.1.i686",
+			"kernel-2.6.32-754.el6.x86_64",
 		}}
-	msg.FilterPackages()
-	assert.Equal(t, 2, len(*msg.Packages))
+	removed := msg.FilterPackages()
+	assert.Equal(t, 4, len(*msg.Packages))
 	assert.Equal(t, "kdepimlibs-akonadi-4.3.4-4.el6.i686", (*msg.Packages)[0])
-	assert.Equal(t, "upstart-0.6.5-6.1.el6_0.1.i686", (*msg.Packages)[1])
+	assert.Equal(t, "lohit-oriya-fonts-2.4.3-6.el6.noarch", (*msg.Packages)[1])
+	assert.Equal(t, "bzip2-debuginfo-1.0.3-4.el5_2.i386", (*msg.Packages)[2])
+	assert.Equal(t, "upstart-0.6.5-6.1.el6_0.1.i686", (*msg.Packages)[3])
+	assert.Equal(t, []FilteredPackage{{Package: "kernel-2.6.32-754.el6.x86_64",
+		Reason: "arch x86_64 not compatible with system arch i686"}}, removed)
+}
+
+func TestFilterMultilib(t *testing.T)  {
+	msg := Message{
+		Arch: "x86_64",
+		Packages: &[]string{
+			"glibc-2.17-292.el7.x86_64",
+			"glibc-2.17-292.el7.i686",
+			"tzdata-2019c-1.el7.noarch",
+			"glibc-2.17-292.el7.src",
+		}}
+	removed := msg.FilterPackages()
+	assert.Equal(t, 3, len(*msg.Packages))
+	assert.Equal(t, 1, len(removed))
+	assert.Equal(t, "glibc-2.17-292.el7.src", removed[0].Package)
+}
+
+func TestFilterUnparsable(t *testing.T)  {
+	msg := Message{
+		Arch: "x86_64",
+		Packages: &[]string{
+			"not-a-package",
+			"bash-4.2.46-34.el7.x86_64",
+		}}
+	removed := msg.FilterPackages()
+	assert.Equal(t, 1, len(*msg.Packages))
+	assert.Equal(t, "bash-4.2.46-34.el7.x86_64", (*msg.Packages)[0])
+	assert.Equal(t, `unable to parse "not-a-package": missing arch`, removed[0].Reason)
 }
 
 func TestToJSON(t *testing.T)  {
@@ -0,0 +1,58 @@
+package listener
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// inventory events by event type and processing result
+	eventsCnt = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Help:      "How many inventory events were processed, by type and result",
+		Namespace: "patchman_engine",
+		Subsystem: "listener",
+		Name:      "inventory_events",
+	}, []string{"type", "result"})
+
+	// messages sent to dead-letter topic by source topic
+	deadLettersCnt = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Help:      "How many messages were sent to dead-letter topic, by source topic",
+		Namespace: "patchman_engine",
+		Subsystem: "listener",
+		Name:      "dead_letters",
+	}, []string{"topic"})
+
+	// flushed hosts, written or skipped because of unchanged profile checksum
+	hostsCnt = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Help:      "How many buffered hosts were written to database or skipped as unchanged",
+		Namespace: "patchman_engine",
+		Subsystem: "listener",
+		Name:      "hosts",
+	}, []string{"result"})
+
+	flushDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Help:      "How long it took to write buffered hosts to database",
+		Namespace: "patchman_engine",
+		Subsystem: "listener",
+		Name:      "flush_duration_seconds",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+	})
+
+	flushBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Help:      "How many hosts were written to database in one flush",
+		Namespace: "patchman_engine",
+		Subsystem: "listener",
+		Name:      "flush_batch_size",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	})
+)
+
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+	resultWritten = "written"
+	resultSkipped = "skipped"
+)
+
+func init() {
+	prometheus.MustRegister(eventsCnt, deadLettersCnt, hostsCnt, flushDuration, flushBatchSize)
+}
@@ -0,0 +1,101 @@
+package listener
+
+import (
+	"app/base/database"
+	"app/base/structures"
+	"app/base/utils"
+	"app/evaluator"
+	"encoding/json"
+	"github.com/jinzhu/gorm"
+)
+
+// sync system_package rows of stored host with packages from its uploaded profile, return system id
+// missing packages and names are created, packages no longer installed are removed from the system
+func updateSystemPackages(tx *gorm.DB, host *structures.HostDAO) (int, error) {
+	// host id is assigned by database on insert
+	var stored structures.HostDAO
+	err := tx.Select("id").Where("inventory_id = ?", host.InventoryID).First(&stored).Error
+	if err != nil {
+		return 0, err
+	}
+	if host.Request == "" {
+		return stored.ID, nil
+	}
+
+	var profile Message
+	err = json.Unmarshal([]byte(host.Request), &profile)
+	if err != nil {
+		return 0, err
+	}
+	var nevras []string
+	if profile.Packages != nil {
+		nevras = *profile.Packages
+	}
+
+	packageIDs, err := database.GetOrCreatePackages(tx, nevras)
+	if err != nil {
+		return 0, err
+	}
+
+	var current []structures.SystemPackageDAO
+	err = tx.Where("system_id = ?", stored.ID).Find(&current).Error
+	if err != nil {
+		return 0, err
+	}
+
+	installed := map[int]bool{}
+	for _, id := range packageIDs {
+		installed[id] = true
+	}
+	var removed []int
+	for _, item := range current {
+		if installed[item.PackageID] {
+			delete(installed, item.PackageID)
+		} else {
+			removed = append(removed, item.PackageID)
+		}
+	}
+	var added []int
+	for _, id := range packageIDs {
+		if installed[id] {
+			added = append(added, id)
+			delete(installed, id)
+		}
+	}
+
+	err = database.InChunks(len(removed), func(start, end int) error {
+		return tx.Where("system_id = ? AND package_id IN (?)", stored.ID, removed[start:end]).
+			Delete(&structures.SystemPackageDAO{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = database.InChunks(len(added), func(start, end int) error {
+		var vals []interface{}
+		for _, id := range added[start:end] {
+			vals = append(vals, stored.ID, id)
+		}
+		smt := replaceSQL(`INSERT INTO system_package (system_id, package_id) VALUES %s`, "(?, ?)", end-start)
+		_, err := tx.CommonDB().Exec(smt, vals...)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	utils.Log("inventoryID", host.InventoryID, "added", len(added), "removed", len(removed)).
+		Debug("system packages updated")
+	return stored.ID, nil
+}
+
+// evaluate written systems, each in its own transaction, so updates service outage doesn't fail host writes
+// systems which can't be evaluated now are evaluated by the next periodic evaluation
+func evaluateSystems(systemIDs []int) {
+	for _, id := range systemIDs {
+		err := database.Transaction(func(tx *gorm.DB) error {
+			return evaluator.EvaluateSystem(tx, id)
+		})
+		if err != nil {
+			utils.Log("systemID", id, "err", err.Error()).Error("unable to evaluate system")
+		}
+	}
+}
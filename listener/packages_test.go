@@ -0,0 +1,91 @@
+package listener
+
+import (
+	"app/base/core"
+	"app/base/database"
+	"app/base/structures"
+	"github.com/bmizerany/assert"
+	"testing"
+	"time"
+)
+
+func testHost(inventoryID string, packages ...string) *structures.HostDAO {
+	msg := Message{Arch: "x86_64", Packages: &packages}
+	return &structures.HostDAO{InventoryID: inventoryID, Request: string(msg.ToJSON()), Checksum: msg.JSONChecksum()}
+}
+
+func systemPackages(t *testing.T, inventoryID string) []string {
+	var nevras []string
+	rows, err := database.Db.Table("system_package sp").
+		Select("pn.name, p.version, p.release, p.arch").
+		Joins("JOIN hosts h ON h.id = sp.system_id").
+		Joins("JOIN package p ON p.id = sp.package_id").
+		Joins("JOIN package_name pn ON pn.id = p.name_id").
+		Where("h.inventory_id = ?", inventoryID).Order("pn.name, p.version").Rows()
+	assert.Equal(t, nil, err)
+	defer rows.Close()
+	for rows.Next() {
+		var name, version, release, arch string
+		assert.Equal(t, nil, rows.Scan(&name, &version, &release, &arch))
+		nevras = append(nevras, name+"-"+version+"-"+release+"."+arch)
+	}
+	return nevras
+}
+
+func TestUpdateSystemPackages(t *testing.T) {
+	core.SetupTestEnvironment()
+	storage := InitStorage(10, true)
+
+	assert.Equal(t, nil, storage.Add(testHost("INV-1", "bash-4.2.46-34.el7.x86_64", "kernel-3.10.0-1062.el7.x86_64")))
+	assert.Equal(t, nil, storage.Add(testHost("INV-2", "bash-4.2.46-34.el7.x86_64")))
+	assert.Equal(t, nil, storage.Flush())
+	assert.Equal(t, []string{"bash-4.2.46-34.el7.x86_64", "kernel-3.10.0-1062.el7.x86_64"}, systemPackages(t, "INV-1"))
+	assert.Equal(t, []string{"bash-4.2.46-34.el7.x86_64"}, systemPackages(t, "INV-2"))
+
+	// updated package replaces the old one, names and packages are shared
+	assert.Equal(t, nil, storage.Add(testHost("INV-1", "bash-4.2.46-35.el7.x86_64", "kernel-3.10.0-1062.el7.x86_64")))
+	assert.Equal(t, nil, storage.Flush())
+	assert.Equal(t, []string{"bash-4.2.46-35.el7.x86_64", "kernel-3.10.0-1062.el7.x86_64"}, systemPackages(t, "INV-1"))
+	assert.Equal(t, []string{"bash-4.2.46-34.el7.x86_64"}, systemPackages(t, "INV-2"))
+
+	cnt := 0
+	database.Db.Model(&structures.PackageNameDAO{}).Count(&cnt)
+	assert.Equal(t, 2, cnt)
+	database.Db.Model(&structures.PackageDAO{}).Count(&cnt)
+	assert.Equal(t, 3, cnt)
+}
+
+func TestUpdateSystemPackagesEpoch(t *testing.T) {
+	core.SetupTestEnvironment()
+	storage := InitStorage(10, false)
+
+	assert.Equal(t, nil, storage.Add(testHost("INV-1", "openssl-1:1.0.2k-19.el7.x86_64")))
+	assert.Equal(t, nil, storage.Flush())
+
+	var pkg structures.PackageDAO
+	assert.Equal(t, nil, database.Db.First(&pkg).Error)
+	assert.Equal(t, 1, pkg.Epoch)
+	assert.Equal(t, "1.0.2k", pkg.Version)
+}
+
+func TestDeleteHostPackages(t *testing.T) {
+	core.SetupTestEnvironment()
+	storage := InitStorage(10, false)
+
+	assert.Equal(t, nil, storage.Add(testHost("INV-1", "bash-4.2.46-34.el7.x86_64")))
+	assert.Equal(t, nil, storage.Flush())
+	var host structures.HostDAO
+	assert.Equal(t, nil, database.Db.Where("inventory_id = ?", "INV-1").First(&host).Error)
+	advisory := structures.AdvisoryMetadataDAO{Name: "RHSA-2020:0001", AdvisoryType: "security",
+		Issued: time.Now(), Updated: time.Now()}
+	assert.Equal(t, nil, database.Db.Create(&advisory).Error)
+	assert.Equal(t, nil, database.Db.Create(&structures.SystemAdvisoriesDAO{SystemID: host.ID,
+		AdvisoryID: advisory.ID, FirstReported: time.Now()}).Error)
+	assert.Equal(t, nil, deleteHost("INV-1"))
+
+	cnt := 0
+	database.Db.Model(&structures.SystemPackageDAO{}).Count(&cnt)
+	assert.Equal(t, 0, cnt)
+	database.Db.Model(&structures.SystemAdvisoriesDAO{}).Count(&cnt)
+	assert.Equal(t, 0, cnt)
+}
@@ -4,107 +4,516 @@ import (
 	"app/base/database"
 	"app/base/structures"
 	"app/base/utils"
+	"context"
+	"database/sql"
 	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/segmentio/kafka-go"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// commits offsets of processed messages, implemented by kafka.Reader
+type messageCommitter interface {
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// buffer of hosts written to database in batches
+// safe for concurrent use, flushed when full by Add or after max latency by RunFlusher
+// hosts are written outside of the lock, so Add doesn't wait for running flush
 type Storage struct {
+	lock          sync.Mutex
 	buffer        *[]structures.HostDAO
+	capacity      int
 	useBatchWrite bool
+	// source message of each buffered host, used for dead-letter topic
+	sources []kafka.Message
+	// failed writes of each buffered host, transient errors are not counted
+	attempts []int
+	// buffer index by inventory id, newer upload of the same host replaces the buffered one
+	index map[string]int
+	// messages of buffered hosts, committed only after the hosts are written
+	pending   []kafka.Message
+	committer messageCommitter
+	// consecutive failed flushes, next flush is delayed until retryAt
+	failedFlushes int
+	retryAt       time.Time
+	// when the oldest not flushed host or message was added
+	oldest time.Time
+	// only one flush at a time
+	flushLock sync.Mutex
+	// hosts and messages taken by running flush
+	flushingHosts int
+	flushingMsgs  int
+	// systems written by flushes, evaluated by RunEvaluator, so flushes don't wait for updates service
+	toEvaluate    map[int]bool
+	evaluateReady chan struct{}
+}
+
+// hosts and messages taken from the buffer by flush
+type storageBatch struct {
+	hosts    []structures.HostDAO
+	sources  []kafka.Message
+	attempts []int
+	pending  []kafka.Message
+	oldest   time.Time
+	// new or changed systems written by flush
+	evaluate []int
 }
 
 func InitStorage(bufferSize int, useBatchWrite bool) *Storage{
-	buffer := make([]structures.HostDAO, 0, bufferSize) // init empty array with given capacity
-	storage := Storage{buffer: &buffer, useBatchWrite: useBatchWrite}
+	storage := Storage{capacity: bufferSize, useBatchWrite: useBatchWrite, toEvaluate: map[int]bool{},
+		evaluateReady: make(chan struct{}, 1)}
+	storage.clean()
 	utils.Log("useBatchWrite", useBatchWrite).Info("buffered storage created")
 	return &storage
 }
 
-func (s *Storage) Add(host *structures.HostDAO) error {
-	if s.Capacity() == s.StoredItems() {
-		err := s.Flush()
-		if err != nil {
-			return err
+// add host to buffer and flush the buffer when it's full
+// host can be nil when message produced nothing to write, message is still committed with next flush
+// when flush fails, hosts stay buffered and are written by next successful flush
+func (s *Storage) Add(host *structures.HostDAO, msgs ...kafka.Message) error {
+	s.lock.Lock()
+	if s.isEmpty() {
+		s.oldest = time.Now()
+	}
+	if host != nil {
+		source := kafka.Message{}
+		if len(msgs) > 0 {
+			source = msgs[0]
 		}
+		s.add(*host, source, 0)
+	}
+	s.pending = append(s.pending, msgs...)
+	full := len(*s.buffer) >= s.capacity
+	retryAt := s.retryAt
+	s.lock.Unlock()
+
+	if full {
+		// full buffer after failed flush, slow down the consumer until the retry
+		time.Sleep(time.Until(retryAt))
+		return s.Flush()
 	}
-	*s.buffer = append(*s.buffer, *host)
 	return nil
 }
 
+// buffer host, replace buffered upload of the same host
+func (s *Storage) add(host structures.HostDAO, source kafka.Message, attempts int) {
+	if i, ok := s.index[host.InventoryID]; ok {
+		// one statement can't upsert the same row twice
+		(*s.buffer)[i] = host
+		s.sources[i] = source
+		s.attempts[i] = attempts
+		return
+	}
+	s.index[host.InventoryID] = len(*s.buffer)
+	*s.buffer = append(*s.buffer, host)
+	s.sources = append(s.sources, source)
+	s.attempts = append(s.attempts, attempts)
+}
+
+// drop buffered upload of the host, its message is still committed with next flush
+func (s *Storage) remove(inventoryID string) {
+	i, ok := s.index[inventoryID]
+	if !ok {
+		return
+	}
+	*s.buffer = append((*s.buffer)[:i], (*s.buffer)[i+1:]...)
+	s.sources = append(s.sources[:i], s.sources[i+1:]...)
+	s.attempts = append(s.attempts[:i], s.attempts[i+1:]...)
+	delete(s.index, inventoryID)
+	for j := i; j < len(*s.buffer); j++ {
+		s.index[(*s.buffer)[j].InventoryID] = j
+	}
+}
+
+// delete host from database together with its buffered upload, which would create it again on next flush
+// runs between flushes, so no upload of the host is being written meanwhile
+func (s *Storage) Delete(inventoryID string) error {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+
+	s.lock.Lock()
+	s.remove(inventoryID)
+	s.lock.Unlock()
+	return deleteHost(inventoryID)
+}
+
+// buffered hosts, including the ones being flushed
 func (s *Storage) StoredItems() int {
-	return len(*s.buffer)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(*s.buffer) + s.flushingHosts
 }
 
 func (s *Storage) Capacity() int {
-	return cap(*s.buffer)
+	return s.capacity
+}
+
+// not committed messages, including the ones being flushed
+func (s *Storage) PendingMessages() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.pending) + s.flushingMsgs
+}
+
+func (s *Storage) isEmpty() bool {
+	return len(*s.buffer) == 0 && len(s.pending) == 0
+}
+
+// flush the buffer whenever its oldest item waits longer than maxLatency, until ctx is done
+func (s *Storage) RunFlusher(ctx context.Context, maxLatency time.Duration) {
+	// flusher checks the buffer 4 times per max latency
+	ticker := time.NewTicker(maxLatency / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.flushOlderThan(maxLatency)
+			if err != nil {
+				utils.Log("err", err.Error()).Error("unable to flush storage")
+			}
+		}
+	}
+}
+
+func (s *Storage) flushOlderThan(maxLatency time.Duration) error {
+	s.lock.Lock()
+	ready := !s.isEmpty() && time.Since(s.oldest) >= maxLatency && !time.Now().Before(s.retryAt)
+	s.lock.Unlock()
+	if !ready {
+		return nil
+	}
+	return s.Flush()
 }
 
+// empty the buffer, new slices are allocated as the old ones may be still flushed
 func (s *Storage) clean() {
-	*s.buffer = (*s.buffer)[:0]
+	buffer := make([]structures.HostDAO, 0, s.capacity)
+	s.buffer = &buffer
+	s.sources = nil
+	s.attempts = nil
+	s.index = map[string]int{}
+	s.pending = nil
+}
+
+// take buffered hosts and messages for flush, buffer is empty afterwards
+func (s *Storage) take() storageBatch {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	batch := storageBatch{hosts: *s.buffer, sources: s.sources, attempts: s.attempts, pending: s.pending,
+		oldest: s.oldest}
+	s.flushingHosts, s.flushingMsgs = len(batch.hosts), len(batch.pending)
+	s.clean()
+	return batch
 }
 
+// return hosts and messages which weren't flushed to the buffer, before the ones added meanwhile
+// newer upload of the same host added meanwhile is kept instead of the returned one
+func (s *Storage) putBack(batch storageBatch, flushErr error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	hosts, sources, attempts, pending := *s.buffer, s.sources, s.attempts, s.pending
+	s.clean()
+	s.pending = append(batch.pending, pending...)
+	s.flushingHosts, s.flushingMsgs = 0, 0
+	for i, host := range batch.hosts {
+		s.add(host, batch.sources[i], batch.attempts[i])
+	}
+	for i, host := range hosts {
+		s.add(host, sources[i], attempts[i])
+	}
+	if !s.isEmpty() {
+		s.oldest = batch.oldest
+	}
+
+	if flushErr != nil {
+		s.failedFlushes++
+		s.retryAt = time.Now().Add(retryBackoff(s.failedFlushes))
+	} else {
+		s.failedFlushes = 0
+		s.retryAt = time.Time{}
+	}
+}
+
+// write buffered hosts, then commit their messages in one batch
+// hosts failing with connection or timeout errors stay buffered and nothing is committed,
+// next flush is retried with growing delay
+// a host failing with other error maxProcessingAttempts times is sent to dead-letter topic,
+// it stays buffered when it can't be sent there
+// written systems are queued for evaluation by RunEvaluator
 func (s *Storage) Flush() error {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+
+	batch := s.take()
+	err := s.flush(&batch)
+	if err == nil {
+		err = s.commit(batch.pending)
+		if err == nil {
+			batch.pending = nil
+		}
+	}
+	s.putBack(batch, err)
+	s.queueEvaluation(batch.evaluate)
+	return err
+}
+
+// add systems to evaluation queue and wake up evaluator, system queued more times is evaluated once
+func (s *Storage) queueEvaluation(systemIDs []int) {
+	if len(systemIDs) == 0 {
+		return
+	}
+	s.lock.Lock()
+	for _, id := range systemIDs {
+		s.toEvaluate[id] = true
+	}
+	s.lock.Unlock()
+	select {
+	case s.evaluateReady <- struct{}{}:
+	default:
+		// evaluator is already woken up
+	}
+}
+
+// evaluate queued systems until ctx is done
+// systems queued when it stops are evaluated by the next periodic evaluation
+func (s *Storage) RunEvaluator(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.evaluateReady:
+			s.evaluateQueued()
+		}
+	}
+}
+
+// systems waiting for evaluation
+func (s *Storage) queuedEvaluations() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.toEvaluate)
+}
+
+func (s *Storage) evaluateQueued() {
+	s.lock.Lock()
+	systemIDs := make([]int, 0, len(s.toEvaluate))
+	for id := range s.toEvaluate {
+		systemIDs = append(systemIDs, id)
+	}
+	s.toEvaluate = map[int]bool{}
+	s.lock.Unlock()
+	sort.Ints(systemIDs)
+	evaluateSystems(systemIDs)
+}
+
+// write hosts of the batch, the ones which weren't written or dead-lettered stay in the batch
+func (s *Storage) flush(batch *storageBatch) error {
+	batchSize := len(batch.hosts)
+	start := time.Now()
+	var err error
 	if s.useBatchWrite {
-		err := s.flushBatch()
-		return err
+		err = flushBatch(batch)
+		if err != nil && !database.IsTransient(err) {
+			// find the hosts which can't be written
+			err = flushEach(batch)
+		}
 	} else {
-		err := s.flushSimple()
+		err = flushEach(batch)
+	}
+	if batchSize > 0 {
+		flushDuration.Observe(time.Since(start).Seconds())
+		flushBatchSize.Observe(float64(batchSize))
+	}
+	if handled := batchSize - len(batch.hosts); handled > 0 {
+		reportWritten(handled, len(batch.evaluate))
+	}
+	return err
+}
+
+// report hosts removed from buffer, the unchanged and dead-lettered ones are skipped
+func reportWritten(handled int, written int) {
+	skipped := handled - written
+	hostsCnt.WithLabelValues(resultWritten).Add(float64(written))
+	hostsCnt.WithLabelValues(resultSkipped).Add(float64(skipped))
+	utils.Log("written", written, "skipped", skipped).Debug("storage flushed")
+}
+
+// write all hosts in one transaction
+func flushBatch(batch *storageBatch) error {
+	if len(batch.hosts) == 0 {
+		return nil
+	}
+	written, err := writeHostsTx(batch.hosts)
+	if err != nil {
 		return err
 	}
+	batch.evaluate = append(batch.evaluate, written...)
+	batch.hosts, batch.sources, batch.attempts = nil, nil, nil
+	return nil
 }
 
-// slower solution working with both PostgreSQL and SQLite
-func (s *Storage) flushSimple() error {
-	for _, item := range *s.buffer {
-		err := database.Db.Save(&item).Error
-		if err != nil {
-			return err
+// write hosts one by one, host per transaction
+// written and dead-lettered hosts are removed from the batch, returns error of the first kept one
+// after transient error the remaining hosts are kept without trying
+func flushEach(batch *storageBatch) error {
+	var firstErr error
+	down := false
+	kept := 0
+	for i, item := range batch.hosts {
+		if !down {
+			written, err := writeHostsTx([]structures.HostDAO{item})
+			if err == nil {
+				batch.evaluate = append(batch.evaluate, written...)
+				continue
+			}
+			utils.Log("inventoryID", item.InventoryID, "err", err.Error()).Error("unable to write host")
+			down = database.IsTransient(err)
+			if !down {
+				batch.attempts[i]++
+				if batch.attempts[i] >= maxProcessingAttempts {
+					dlqErr := deadLetter(context.Background(), batch.sources[i], err, batch.attempts[i])
+					if dlqErr == nil {
+						continue
+					}
+					// kept uncommitted, dead-lettered by next flush
+					utils.Log("inventoryID", item.InventoryID, "err", dlqErr.Error()).
+						Error("unable to write host to dead-letter topic")
+					err = dlqErr
+				}
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
 		}
+		batch.hosts[kept], batch.sources[kept], batch.attempts[kept] = item, batch.sources[i], batch.attempts[i]
+		kept++
 	}
-	s.clean()
-	return nil
+	batch.hosts = batch.hosts[:kept]
+	batch.sources = batch.sources[:kept]
+	batch.attempts = batch.attempts[:kept]
+	return firstErr
 }
 
-// https://stackoverflow.com/questions/12486436/how-do-i-batch-sql-statements-with-package-database-sql
-func replaceSQL(stmt, pattern string, len int) string {
-    pattern += ","
-    stmt = fmt.Sprintf(stmt, strings.Repeat(pattern, len))
-    n := 0
-    for strings.IndexByte(stmt, '?') != -1 {
-        n++
-        param := "$" + strconv.Itoa(n)
-        stmt = strings.Replace(stmt, "?", param, 1)
-    }
-    return strings.TrimSuffix(stmt, ",")
+func (s *Storage) commit(msgs []kafka.Message) error {
+	if len(msgs) == 0 || s.committer == nil {
+		return nil
+	}
+	return s.committer.CommitMessages(context.Background(), msgs...)
+}
+
+// insert new hosts and update existing ones, upload time is updated even when profile didn't change
+// account of existing host is never changed, see changedHosts
+// works with both PostgreSQL and SQLite (3.24+)
+const (
+	insertHostsSQL = `INSERT INTO hosts(inventory_id, account, request, checksum, last_upload) VALUES %s`
+	upsertHostsSQL = ` ON CONFLICT (inventory_id) DO UPDATE
+		SET request = excluded.request, checksum = excluded.checksum, last_upload = excluded.last_upload`
+)
+
+// implemented by sql.DB and sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
-// use writing into the database in batches, doesn't work with SQLite
-func (s *Storage) flushBatch() error {
+// upsert hosts in single statement
+func upsertHosts(db execer, hosts []structures.HostDAO) error {
 	var vals []interface{}
-	for _, item := range *s.buffer  {
-		vals = append(vals, item.ID, item.Request, item.Checksum)
+	for _, item := range hosts {
+		vals = append(vals, item.InventoryID, item.Account, item.Request, item.Checksum, item.LastUpload)
 	}
 
-	smt := `INSERT INTO hosts(id, request, checksum) VALUES %s`
-	smt = replaceSQL(smt, "(?, ?, ?)", len(*s.buffer))
-	tx, err := database.Db.DB().Begin()
+	smt := replaceSQL(insertHostsSQL, "(?, ?, ?, ?, ?)", len(hosts)) + upsertHostsSQL
+	_, err := db.Exec(smt, vals...)
+	return err
+}
 
-	if err != nil {
+// write hosts in new transaction
+func writeHostsTx(hosts []structures.HostDAO) ([]int, error) {
+	var written []int
+	err := database.Transaction(func(tx *gorm.DB) (err error) {
+		written, err = writeHosts(tx, hosts)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return written, nil
+}
 
-	_, err = tx.Exec(smt, vals...)
+// upsert hosts and update packages of the changed ones, return ids of new or changed systems
+func writeHosts(tx *gorm.DB, hosts []structures.HostDAO) ([]int, error) {
+	changed, err := changedHosts(tx, hosts)
 	if err != nil {
-		errRb := tx.Rollback()
-		if errRb != nil {
-			return errRb
-		}
-		return err
+		return nil, err
 	}
-	err = tx.Commit()
+	err = upsertHosts(tx.CommonDB(), hosts)
 	if err != nil {
+		return nil, err
+	}
+	var written []int
+	for i := range hosts {
+		if !changed[hosts[i].InventoryID] {
+			continue
+		}
+		systemID, err := updateSystemPackages(tx, &hosts[i])
+		if err != nil {
+			return nil, err
+		}
+		written = append(written, systemID)
+	}
+	return written, nil
+}
+
+// inventory ids of hosts which are not stored yet or have different profile checksum
+// fails when a host is already stored under different account
+func changedHosts(tx *gorm.DB, hosts []structures.HostDAO) (map[string]bool, error) {
+	ids := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		ids = append(ids, host.InventoryID)
+	}
+
+	stored := make(map[string]structures.HostDAO, len(hosts))
+	err := database.InChunks(len(ids), func(start, end int) error {
+		var rows []structures.HostDAO
+		err := tx.Select("inventory_id, account, checksum").Where("inventory_id IN (?)", ids[start:end]).
+			Find(&rows).Error
+		for _, row := range rows {
+			stored[row.InventoryID] = row
+		}
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+
+	changed := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		row, ok := stored[host.InventoryID]
+		if ok && row.Account != host.Account {
+			return nil, fmt.Errorf("host %s belongs to another account", host.InventoryID)
+		}
+		changed[host.InventoryID] = !ok || row.Checksum != host.Checksum
+	}
+	return changed, nil
+}
+
+// https://stackoverflow.com/questions/12486436/how-do-i-batch-sql-statements-with-package-database-sql
+func replaceSQL(stmt, pattern string, len int) string {
+    pattern += ","
+    stmt = fmt.Sprintf(stmt, strings.Repeat(pattern, len))
+    n := 0
+    for strings.IndexByte(stmt, '?') != -1 {
+        n++
+        param := "$" + strconv.Itoa(n)
+        stmt = strings.Replace(stmt, "?", param, 1)
+    }
+    return strings.TrimSuffix(stmt, ",")
 }
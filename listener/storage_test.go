@@ -3,8 +3,17 @@ package listener
 import (
 	"app/base/database"
 	"app/base/structures"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/bmizerany/assert"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/segmentio/kafka-go"
+	"sync"
 	"testing"
+	"time"
 
 	"app/base/core"
 )
@@ -19,7 +28,7 @@ func TestStorageFlush(t *testing.T) {
 	core.SetupTestEnvironment()
 	storage := InitStorage(3, false)
 
-	for _, item := range []structures.HostDAO{{ID: 1}, {ID: 2}} {
+	for _, item := range []structures.HostDAO{{ID: 1, InventoryID: "INV-1"}, {ID: 2, InventoryID: "INV-2"}} {
 		err := storage.Add(&item)
 		assert.Equal(t, nil, err)
 	}
@@ -39,7 +48,8 @@ func TestStorageBuffer(t *testing.T) {
 	core.SetupTestEnvironment()
 	storage := InitStorage(2, false)
 
-	for _, item := range []structures.HostDAO{{ID: 1}, {ID: 2}, {ID: 3}} {
+	for _, item := range []structures.HostDAO{{ID: 1, InventoryID: "INV-1"}, {ID: 2, InventoryID: "INV-2"},
+		{ID: 3, InventoryID: "INV-3"}} {
 		err := storage.Add(&item)
 		assert.Equal(t, nil, err)
 	}
@@ -51,3 +61,237 @@ func TestStorageBuffer(t *testing.T) {
 	database.Db.Model(&structures.HostDAO{}).Count(&cnt)
 	assert.Equal(t, 2, cnt)
 }
+
+type testCommitter struct {
+	committed []kafka.Message
+	err       error
+}
+
+func (c *testCommitter) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.committed = append(c.committed, msgs...)
+	return nil
+}
+
+func TestStorageCommitAfterFlush(t *testing.T) {
+	core.SetupTestEnvironment()
+	committer := &testCommitter{}
+	storage := InitStorage(2, false)
+	storage.committer = committer
+
+	err := storage.Add(&structures.HostDAO{InventoryID: "INV-1"}, kafka.Message{Offset: 1})
+	assert.Equal(t, nil, err)
+	err = storage.Add(nil, kafka.Message{Offset: 2})
+	assert.Equal(t, nil, err)
+	// nothing written yet, nothing committed
+	assert.Equal(t, 0, len(committer.committed))
+	assert.Equal(t, 2, storage.PendingMessages())
+
+	err = storage.Add(&structures.HostDAO{InventoryID: "INV-2"}, kafka.Message{Offset: 3})
+	assert.Equal(t, nil, err)
+	// buffer full, flushed and committed in one batch
+	assert.Equal(t, 3, len(committer.committed))
+	assert.Equal(t, int64(3), committer.committed[2].Offset)
+	assert.Equal(t, 0, storage.PendingMessages())
+}
+
+func TestStorageCommitFailed(t *testing.T) {
+	core.SetupTestEnvironment()
+	committer := &testCommitter{err: errors.New("commit failed")}
+	storage := InitStorage(1, false)
+	storage.committer = committer
+
+	err := storage.Add(&structures.HostDAO{InventoryID: "INV-1"}, kafka.Message{Offset: 1})
+	assert.Equal(t, committer.err, err)
+	// written, but kept for the next commit
+	cnt, _ := database.HostsCount()
+	assert.Equal(t, 1, cnt)
+	assert.Equal(t, 1, storage.PendingMessages())
+
+	committer.err = nil
+	assert.Equal(t, nil, storage.Flush())
+	assert.Equal(t, 1, len(committer.committed))
+	assert.Equal(t, 0, storage.PendingMessages())
+}
+
+func histogramCount(t *testing.T, histogram prometheus.Histogram) uint64 {
+	var metric dto.Metric
+	assert.Equal(t, nil, histogram.Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestStorageTimeFlush(t *testing.T) {
+	core.SetupTestEnvironment()
+	committer := &testCommitter{}
+	storage := InitStorage(100, false)
+	storage.committer = committer
+	flushes := histogramCount(t, flushBatchSize)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go storage.RunFlusher(ctx, 20*time.Millisecond)
+
+	err := storage.Add(&structures.HostDAO{InventoryID: "INV-1"}, kafka.Message{Offset: 1})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, storage.StoredItems())
+
+	// far from full, written after max latency
+	for i := 0; i < 100 && storage.PendingMessages() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 0, storage.StoredItems())
+	assert.Equal(t, 0, storage.PendingMessages())
+	cnt, _ := database.HostsCount()
+	assert.Equal(t, 1, cnt)
+	assert.Equal(t, flushes+1, histogramCount(t, flushBatchSize))
+}
+
+func TestStorageConcurrentAdd(t *testing.T) {
+	core.SetupTestEnvironment()
+	committer := &testCommitter{}
+	storage := InitStorage(7, false)
+	storage.committer = committer
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				host := structures.HostDAO{InventoryID: fmt.Sprintf("INV-%d-%d", i, j)}
+				assert.Equal(t, nil, storage.Add(&host, kafka.Message{}))
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, nil, storage.Flush())
+
+	cnt, _ := database.HostsCount()
+	assert.Equal(t, 100, cnt)
+	assert.Equal(t, 100, len(committer.committed))
+}
+
+func testStorageUpsert(t *testing.T, useBatchWrite bool) {
+	core.SetupTestEnvironment()
+	storage := InitStorage(10, useBatchWrite)
+	written := testutil.ToFloat64(hostsCnt.WithLabelValues(resultWritten))
+	skipped := testutil.ToFloat64(hostsCnt.WithLabelValues(resultSkipped))
+
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-1", Request: `{"id":1}`, Checksum: "1"}))
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-2", Request: `{"id":2}`, Checksum: "2"}))
+	assert.Equal(t, nil, storage.Flush())
+
+	// re-delivered upload is skipped, changed one is updated
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-1", Request: `{"id":1}`, Checksum: "1"}))
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-2", Request: `{"id":3}`, Checksum: "2b"}))
+	assert.Equal(t, nil, storage.Flush())
+
+	cnt, _ := database.HostsCount()
+	assert.Equal(t, 2, cnt)
+	var host structures.HostDAO
+	assert.Equal(t, nil, database.Db.Where("inventory_id = ?", "INV-2").First(&host).Error)
+	assert.Equal(t, `{"id":3}`, host.Request)
+	assert.Equal(t, "2b", host.Checksum)
+	assert.Equal(t, written+3, testutil.ToFloat64(hostsCnt.WithLabelValues(resultWritten)))
+	assert.Equal(t, skipped+1, testutil.ToFloat64(hostsCnt.WithLabelValues(resultSkipped)))
+}
+
+func TestStorageUpsertSimple(t *testing.T) {
+	testStorageUpsert(t, false)
+}
+
+func TestStorageUpsertBatch(t *testing.T) {
+	testStorageUpsert(t, true)
+}
+
+func TestStorageAddSameHost(t *testing.T) {
+	core.SetupTestEnvironment()
+	committer := &testCommitter{}
+	storage := InitStorage(10, true)
+	storage.committer = committer
+
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-1", Checksum: "1"}, kafka.Message{Offset: 1}))
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-1", Checksum: "2"}, kafka.Message{Offset: 2}))
+	// newer upload replaces the buffered one, both messages are committed
+	assert.Equal(t, 1, storage.StoredItems())
+	assert.Equal(t, 2, storage.PendingMessages())
+	assert.Equal(t, nil, storage.Flush())
+	assert.Equal(t, 2, len(committer.committed))
+
+	var host structures.HostDAO
+	assert.Equal(t, nil, database.Db.Where("inventory_id = ?", "INV-1").First(&host).Error)
+	assert.Equal(t, "2", host.Checksum)
+}
+
+func TestStoragePutBack(t *testing.T) {
+	core.SetupTestEnvironment()
+	storage := InitStorage(10, false)
+
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-1", Checksum: "1"}, kafka.Message{Offset: 1}))
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-2", Checksum: "1"}, kafka.Message{Offset: 2}))
+	batch := storage.take()
+	// added while the batch is flushed
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-2", Checksum: "2"}, kafka.Message{Offset: 3}))
+	assert.Equal(t, 3, storage.StoredItems())
+	assert.Equal(t, 3, storage.PendingMessages())
+
+	// failed hosts returned to the buffer, newer upload of the same host kept
+	storage.putBack(batch, errors.New("write failed"))
+	assert.Equal(t, 2, storage.StoredItems())
+	assert.Equal(t, 3, storage.PendingMessages())
+	assert.Equal(t, "2", (*storage.buffer)[storage.index["INV-2"]].Checksum)
+	assert.Equal(t, 1, storage.failedFlushes)
+}
+
+func TestStorageAccountMismatch(t *testing.T) {
+	core.SetupTestEnvironment()
+	writer := setupDLQ(1)
+	committer := &testCommitter{}
+	storage := InitStorage(10, true)
+	storage.committer = committer
+
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-1", Account: "1", Checksum: "1"}))
+	assert.Equal(t, nil, storage.Flush())
+
+	// upload of the same host from another account is rejected, the other host is written
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-1", Account: "2", Checksum: "2"},
+		kafka.Message{Offset: 1}))
+	assert.Equal(t, nil, storage.Add(&structures.HostDAO{InventoryID: "INV-2", Account: "2", Checksum: "2"},
+		kafka.Message{Offset: 2}))
+	assert.Equal(t, nil, storage.Flush())
+	assert.Equal(t, 1, len(writer.written))
+	assert.Equal(t, "host INV-1 belongs to another account", getHeader(writer.written[0].Headers, dlqErrorHeader))
+	assert.Equal(t, 2, len(committer.committed))
+
+	var host structures.HostDAO
+	assert.Equal(t, nil, database.Db.Where("inventory_id = ?", "INV-1").First(&host).Error)
+	assert.Equal(t, "1", host.Account)
+	assert.Equal(t, "1", host.Checksum)
+	cnt, _ := database.HostsCount()
+	assert.Equal(t, 2, cnt)
+}
+
+// flush doesn't wait for evaluation, queued systems are evaluated once
+func TestStorageEvaluationQueue(t *testing.T) {
+	core.SetupTestEnvironment()
+	storage := InitStorage(10, false)
+	storage.queueEvaluation([]int{2, 1})
+	storage.queueEvaluation([]int{1})
+	assert.Equal(t, map[int]bool{1: true, 2: true}, storage.toEvaluate)
+	assert.Equal(t, 1, len(storage.evaluateReady))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		storage.RunEvaluator(ctx)
+		close(done)
+	}()
+	for storage.queuedEvaluations() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	assert.Equal(t, 0, len(storage.evaluateReady))
+}
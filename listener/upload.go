@@ -0,0 +1,156 @@
+package listener
+
+import (
+	"app/base/structures"
+	"app/base/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// uploaded archives bigger than this are rejected
+const maxArchiveSize = 100 * 1024 * 1024
+
+// platform.upload.available message
+type UploadMessage struct {
+	Account     string `json:"account"`
+	InventoryID string `json:"id"`
+	RequestID   string `json:"request_id"`
+	B64Identity string `json:"b64_identity"`
+	URL         string `json:"url"`
+}
+
+// http source of uploaded archives
+type archiveSource struct {
+	client *http.Client
+	// optional, replaces scheme and host of archive url from message, e.g. for local deployment
+	baseURL *url.URL
+}
+
+func newArchiveSource(baseURL string, timeout time.Duration) (*archiveSource, error) {
+	source := archiveSource{client: &http.Client{Timeout: timeout}}
+	if baseURL != "" {
+		parsed, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, err
+		}
+		source.baseURL = parsed
+	}
+	return &source, nil
+}
+
+func (s *archiveSource) download(archiveURL string) ([]byte, error) {
+	parsed, err := url.Parse(archiveURL)
+	if err != nil {
+		return nil, err
+	}
+	if s.baseURL != nil {
+		parsed.Scheme = s.baseURL.Scheme
+		parsed.Host = s.baseURL.Host
+	}
+
+	resp, err := s.client.Get(parsed.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unable to download archive, status %d", resp.StatusCode)
+		// client errors won't be fixed by retrying
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return nil, permanent(err)
+		}
+		return nil, err
+	}
+
+	archive, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxArchiveSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(archive) > maxArchiveSize {
+		return nil, permanent(errors.New("archive too big"))
+	}
+	return archive, nil
+}
+
+// messages which can't be processed go to dead-letter topic,
+// once written there they are committed together with successfully processed ones
+func uploadHandler(ctx context.Context, m kafka.Message) bool {
+	var host *structures.HostDAO
+	attempts, err := withRetries(func() (err error) {
+		host, err = processUploadMessage(m.Value)
+		return err
+	})
+	if err != nil {
+		utils.Log("partition", m.Partition, "offset", m.Offset, "attempts", attempts, "err", err.Error()).
+			Error("unable to process upload")
+		if deadLetterUntilWritten(ctx, m, err, attempts) != nil {
+			// listener is stopping, message is left uncommitted and delivered again
+			return false
+		}
+	}
+
+	err = storage.Add(host, m)
+	if err != nil {
+		utils.Log("err", err.Error()).Error("unable to flush storage")
+	}
+	// committed by storage once the host is written
+	return false
+}
+
+func processUploadMessage(value []byte) (*structures.HostDAO, error) {
+	var msg UploadMessage
+	err := json.Unmarshal(value, &msg)
+	if err != nil {
+		return nil, permanent(err)
+	}
+	return processUpload(&msg)
+}
+
+// download archive and extract system profile
+func processUpload(msg *UploadMessage) (*structures.HostDAO, error) {
+	if msg.InventoryID == "" {
+		return nil, permanent(errors.New("missing inventory id"))
+	}
+	// systems are visible only within their account
+	if msg.Account == "" {
+		return nil, permanent(errors.New("missing account"))
+	}
+	if msg.URL == "" {
+		return nil, permanent(errors.New("missing archive url"))
+	}
+
+	archive, err := source.download(msg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := parseArchive(archive)
+	if err != nil {
+		return nil, permanent(err)
+	}
+
+	removed := profile.FilterPackages()
+	if len(removed) > 0 {
+		utils.Log("inventoryID", msg.InventoryID, "removed", len(removed)).Info("packages filtered out")
+	}
+
+	now := time.Now()
+	host := structures.HostDAO{
+		InventoryID: msg.InventoryID,
+		Account:     msg.Account,
+		LastUpload:  &now,
+		Request:     string(profile.ToJSON()),
+		Checksum:    profile.JSONChecksum(),
+	}
+	utils.Log("inventoryID", msg.InventoryID, "requestID", msg.RequestID).Debug("upload processed")
+	return &host, nil
+}
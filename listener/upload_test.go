@@ -0,0 +1,241 @@
+package listener
+
+import (
+	"app/base/core"
+	"app/base/database"
+	"app/base/structures"
+	"app/base/vmaas"
+	"app/evaluator"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"github.com/bmizerany/assert"
+	"github.com/segmentio/kafka-go"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+const (
+	testInventoryID = "00000000-0000-0000-0000-000000000001"
+	testUnameFile   = "insights-archive/data/insights_commands/uname_-a"
+)
+
+var testArchiveFiles = map[string]string{
+	testUnameFile: "Linux host 3.10.0-1062.el7.x86_64 #1 SMP " +
+		"Thu Jul 18 20:25:13 UTC 2019 x86_64 x86_64 x86_64 GNU/Linux\n",
+	"insights-archive/data/insights_commands/rpm_-qa_--qf_NAME_-_VERSION_-_RELEASE_._ARCH": "" +
+		"bash-4.2.46-34.el7.x86_64    Tue 12 Nov 2019\n" +
+		"glibc-2.17-292.el7.i686    Tue 12 Nov 2019\n" +
+		"tzdata-2019c-1.el7.noarch    Tue 12 Nov 2019\n" +
+		"kernel-3.10.0-1062.el7.src    Tue 12 Nov 2019\n",
+	"insights-archive/data/insights_commands/yum_-C_--noplugins_repolist": "" +
+		"Loaded plugins: product-id\n" +
+		"repo id                              repo name                        status\n" +
+		"rhel-7-server-rpms/7Server/x86_64    Red Hat Enterprise Linux 7       26,654\n" +
+		"!rhel-7-server-extras-rpms/x86_64    Red Hat Enterprise Linux Extras   1,244\n" +
+		"repolist: 27,898\n",
+	"insights-archive/data/etc/dnf/modules.d/nodejs.module": "" +
+		"[nodejs]\nname=nodejs\nstream=10\nprofiles=\nstate=enabled\n",
+	"insights-archive/data/etc/dnf/modules.d/perl.module": "" +
+		"[perl]\nname=perl\nstream=5.24\nprofiles=\nstate=disabled\n",
+}
+
+func createTestArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gz)
+	for name, content := range files {
+		err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)),
+			Typeflag: tar.TypeReg})
+		assert.Equal(t, nil, err)
+		_, err = writer.Write([]byte(content))
+		assert.Equal(t, nil, err)
+	}
+	assert.Equal(t, nil, writer.Close())
+	assert.Equal(t, nil, gz.Close())
+	return buf.Bytes()
+}
+
+// serve archive on /archive.tar.gz, upload source points to the server
+func setupArchiveServer(t *testing.T, archive []byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/archive.tar.gz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(archive)
+	}))
+	var err error
+	source, err = newArchiveSource(server.URL, time.Second)
+	assert.Equal(t, nil, err)
+	return server
+}
+
+func TestParseArchive(t *testing.T) {
+	msg, err := parseArchive(createTestArchive(t, testArchiveFiles))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "x86_64", msg.Arch)
+	assert.Equal(t, []string{"bash-4.2.46-34.el7.x86_64", "glibc-2.17-292.el7.i686", "tzdata-2019c-1.el7.noarch",
+		"kernel-3.10.0-1062.el7.src"}, *msg.Packages)
+	assert.Equal(t, []string{"rhel-7-server-rpms", "rhel-7-server-extras-rpms"}, *msg.Repos)
+	assert.Equal(t, []vmaas.Module{{Name: "nodejs", Stream: "10"}}, *msg.Modules)
+}
+
+func TestParseArchiveMissingPackages(t *testing.T) {
+	_, err := parseArchive(createTestArchive(t, map[string]string{
+		testUnameFile: testArchiveFiles[testUnameFile]}))
+	assert.Equal(t, "archive doesn't contain installed packages", err.Error())
+}
+
+func TestParseArchiveRelativeModules(t *testing.T) {
+	module := testArchiveFiles["insights-archive/data/etc/dnf/modules.d/nodejs.module"]
+	files := map[string]string{"etc/dnf/modules.d/nodejs.module": module}
+	for name, content := range testArchiveFiles {
+		if path.Ext(name) != ".module" {
+			files[name] = content
+		}
+	}
+	msg, err := parseArchive(createTestArchive(t, files))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []vmaas.Module{{Name: "nodejs", Stream: "10"}}, *msg.Modules)
+}
+
+func TestParseArchiveTooBig(t *testing.T) {
+	defer func(size int64) { maxUnpackedSize = size }(maxUnpackedSize)
+	archive := createTestArchive(t, testArchiveFiles)
+
+	// every file fits, all of them don't
+	maxUnpackedSize = 1024
+	_, err := parseArchive(archive)
+	assert.Equal(t, errUnpackedTooBig, err)
+
+	maxUnpackedSize = 100
+	_, err = parseArchive(archive)
+	assert.Equal(t, errUnpackedTooBig, err)
+}
+
+func TestUploadHandler(t *testing.T) {
+	core.SetupTestEnvironment()
+	server := setupArchiveServer(t, createTestArchive(t, testArchiveFiles))
+	defer server.Close()
+	storage = InitStorage(10, false)
+
+	// archive url points to storage service, only path is used
+	value, err := json.Marshal(UploadMessage{Account: "0000001", InventoryID: testInventoryID,
+		URL: "https://s3.example.com/archive.tar.gz"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, uploadHandler(context.Background(), kafka.Message{Value: value}))
+	assert.Equal(t, 1, storage.StoredItems())
+	assert.Equal(t, nil, storage.Flush())
+
+	var host structures.HostDAO
+	err = database.Db.Where("inventory_id = ?", testInventoryID).First(&host).Error
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `{"id":0,"arch":"x86_64","packages":["bash-4.2.46-34.el7.x86_64","glibc-2.17-292.el7.i686",`+
+		`"tzdata-2019c-1.el7.noarch"],"repos":["rhel-7-server-rpms","rhel-7-server-extras-rpms"],`+
+		`"modules":[{"module_name":"nodejs","module_stream":"10"}]}`, host.Request)
+	assert.Equal(t, 64, len(host.Checksum))
+	assert.Equal(t, "0000001", host.Account)
+	assert.NotEqual(t, (*time.Time)(nil), host.LastUpload)
+}
+
+// local backend is used by other tests, it doesn't need VMaaS
+func restoreLocalEvaluator() {
+	_ = os.Setenv("EVALUATOR_BACKEND", "local")
+	evaluator.Configure()
+	os.Unsetenv("EVALUATOR_BACKEND")
+}
+
+func TestUploadEvaluated(t *testing.T) {
+	core.SetupTestEnvironment()
+	server := setupArchiveServer(t, createTestArchive(t, testArchiveFiles))
+	defer server.Close()
+	updates := vmaas.NewFakeServer(nil)
+	defer updates.Close()
+	assert.Equal(t, nil, os.Setenv("EVALUATOR_BACKEND", "vmaas"))
+	assert.Equal(t, nil, os.Setenv("VMAAS_ADDRESS", updates.URL))
+	defer restoreLocalEvaluator()
+	defer os.Unsetenv("VMAAS_ADDRESS")
+	evaluator.Configure()
+	storage = InitStorage(10, false)
+	assert.Equal(t, nil, database.Db.Create(&structures.AdvisoryMetadataDAO{Name: "RHSA-2020:0001",
+		AdvisoryType: "security", Issued: time.Now(), Updated: time.Now()}).Error)
+
+	value, err := json.Marshal(UploadMessage{Account: "0000001", InventoryID: testInventoryID,
+		URL: "https://s3.example.com/archive.tar.gz"})
+	assert.Equal(t, nil, err)
+	uploadHandler(context.Background(), kafka.Message{Value: value})
+	assert.Equal(t, nil, storage.Flush())
+	storage.evaluateQueued()
+
+	var host structures.HostDAO
+	assert.Equal(t, nil, database.Db.Where("inventory_id = ?", testInventoryID).First(&host).Error)
+	assert.Equal(t, 1, host.AdvisorySecCountCache)
+	assert.Equal(t, []string{"rhel-7-server-rpms", "rhel-7-server-extras-rpms"}, updates.Requests()[0].RepositoryList)
+	assert.Equal(t, []vmaas.Module{{Name: "nodejs", Stream: "10"}}, updates.Requests()[0].ModulesList)
+}
+
+func TestUploadEvaluationFailed(t *testing.T) {
+	core.SetupTestEnvironment()
+	server := setupArchiveServer(t, createTestArchive(t, testArchiveFiles))
+	defer server.Close()
+	updates := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer updates.Close()
+	assert.Equal(t, nil, os.Setenv("EVALUATOR_BACKEND", "vmaas"))
+	assert.Equal(t, nil, os.Setenv("VMAAS_ADDRESS", updates.URL))
+	assert.Equal(t, nil, os.Setenv("VMAAS_MAX_ATTEMPTS", "1"))
+	defer restoreLocalEvaluator()
+	defer os.Unsetenv("VMAAS_ADDRESS")
+	defer os.Unsetenv("VMAAS_MAX_ATTEMPTS")
+	evaluator.Configure()
+	committer := &testCommitter{}
+	storage = InitStorage(10, false)
+	storage.committer = committer
+
+	value, err := json.Marshal(UploadMessage{Account: "0000001", InventoryID: testInventoryID,
+		URL: "https://s3.example.com/archive.tar.gz"})
+	assert.Equal(t, nil, err)
+	uploadHandler(context.Background(), kafka.Message{Value: value})
+	// updates service outage doesn't fail the write, system is evaluated later
+	assert.Equal(t, nil, storage.Flush())
+	storage.evaluateQueued()
+	assert.Equal(t, 1, len(committer.committed))
+	assert.Equal(t, []string{"bash-4.2.46-34.el7.x86_64", "glibc-2.17-292.el7.i686", "tzdata-2019c-1.el7.noarch"},
+		systemPackages(t, testInventoryID))
+	var host structures.HostDAO
+	assert.Equal(t, nil, database.Db.Where("inventory_id = ?", testInventoryID).First(&host).Error)
+	assert.Equal(t, (*time.Time)(nil), host.LastEvaluation)
+}
+
+func TestUploadHandlerDownloadFailed(t *testing.T) {
+	core.SetupTestEnvironment()
+	server := setupArchiveServer(t, nil)
+	defer server.Close()
+	storage = InitStorage(10, false)
+
+	_, err := processUpload(&UploadMessage{Account: "0000001", InventoryID: testInventoryID,
+		URL: server.URL + "/missing.tar.gz"})
+	assert.Equal(t, "unable to download archive, status 404", err.Error())
+}
+
+func TestUploadHandlerInvalidMessage(t *testing.T) {
+	storage = InitStorage(10, false)
+
+	_, err := processUpload(&UploadMessage{URL: "https://s3.example.com/archive.tar.gz"})
+	assert.Equal(t, "missing inventory id", err.Error())
+	_, err = processUpload(&UploadMessage{InventoryID: testInventoryID, URL: "https://s3.example.com/archive.tar.gz"})
+	assert.Equal(t, "missing account", err.Error())
+
+	// message is committed with the next flush, even when there is nothing to write
+	uploadHandler(context.Background(), kafka.Message{Value: []byte("not a json")})
+	assert.Equal(t, 0, storage.StoredItems())
+	assert.Equal(t, 1, storage.PendingMessages())
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"app/base/core"
+	"app/base/database"
+	"app/evaluator"
 	"app/listener"
 	"app/manager"
+	"app/vmaas_sync"
 	"log"
 	"os"
 )
@@ -19,6 +22,18 @@ func main() {
 		case "manager":
 			manager.RunManager()
 			return
+		case "dlq_replay":
+			listener.RunDLQReplay()
+			return
+		case "evaluator":
+			evaluator.RunEvaluator()
+			return
+		case "vmaas_sync":
+			vmaas_sync.RunVmaasSync()
+			return
+		case "migrate":
+			database.RunMigrate(os.Args[2:])
+			return
 		}
 	}
 	log.Fatal("You need to provide a command")
@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"app/base/database"
+	"app/base/structures"
+	"app/base/utils"
+	"app/manager/middlewares"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"time"
+)
+
+type AdvisoryItem struct {
+	// advisory name, e.g. RHSA-2019:1234
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Attributes AdvisoryItemAttributes `json:"attributes"`
+}
+
+type AdvisoryItemAttributes struct {
+	Synopsis     string    `json:"synopsis"`
+	Description  string    `json:"description"`
+	AdvisoryType string    `json:"advisory_type"`
+	Severity     *string   `json:"severity"`
+	PublicDate   time.Time `json:"public_date"`
+	ModifiedDate time.Time `json:"modified_date"`
+	// number of systems the advisory is currently applicable to
+	ApplicableSystems int `json:"applicable_systems"`
+}
+
+type AdvisoriesResponse struct {
+	Data  []AdvisoryItem `json:"data"`
+	Meta  ListMeta       `json:"meta"`
+	Links Links          `json:"links"`
+}
+
+type AdvisoryDetailItem struct {
+	ID         string                   `json:"id"`
+	Type       string                   `json:"type"`
+	Attributes AdvisoryDetailAttributes `json:"attributes"`
+}
+
+type AdvisoryDetailAttributes struct {
+	AdvisoryItemAttributes
+	Solution string   `json:"solution"`
+	URL      string   `json:"url"`
+	Cves     []string `json:"cves"`
+	// nevras of fixed packages
+	Packages []string `json:"packages"`
+	// bugzilla ids and other references
+	References      []string `json:"references"`
+	ReleaseVersions []string `json:"release_versions"`
+}
+
+type AdvisoryDetailResponse struct {
+	Data AdvisoryDetailItem `json:"data"`
+}
+
+type advisoryRow struct {
+	structures.AdvisoryMetadataDAO
+	ApplicableSystems int
+}
+
+func (r *advisoryRow) item() AdvisoryItem {
+	return AdvisoryItem{ID: r.Name, Type: "advisory", Attributes: r.attributes()}
+}
+
+func (r *advisoryRow) attributes() AdvisoryItemAttributes {
+	return AdvisoryItemAttributes{
+		Synopsis:          r.Synopsis,
+		Description:       r.Description,
+		AdvisoryType:      r.AdvisoryType,
+		Severity:          r.Severity,
+		PublicDate:        r.Issued,
+		ModifiedDate:      r.Updated,
+		ApplicableSystems: r.ApplicableSystems,
+	}
+}
+
+// joined to advisories, counts systems of the account
+const applicableSystemsJoin = "LEFT JOIN (SELECT sa.advisory_id, count(*) AS applicable_systems " +
+	"FROM system_advisories sa JOIN hosts h ON h.id = sa.system_id " +
+	"WHERE sa.when_patched IS NULL AND h.account = ? GROUP BY sa.advisory_id) ac ON ac.advisory_id = am.id"
+
+const applicableSystemsExpr = "COALESCE(ac.applicable_systems, 0)"
+
+// sortable and filterable attributes of advisories list
+var advisoryAttrs = attrMap{
+	"id":                 {"am.name", attrString},
+	"synopsis":           {"am.synopsis", attrString},
+	"advisory_type":      {"am.advisory_type", attrString},
+	"severity":           {"am.severity", attrString},
+	"public_date":        {"am.issued", attrTime},
+	"modified_date":      {"am.updated", attrTime},
+	"applicable_systems": {applicableSystemsExpr, attrInt},
+}
+
+// advisories with number of account systems they are applicable to
+func advisoriesQuery(tx *gorm.DB, account string) *gorm.DB {
+	return tx.Table("advisory_metadata am").
+		Select("am.*, "+applicableSystemsExpr+" AS applicable_systems").
+		Joins(applicableSystemsJoin, account)
+}
+
+func AdvisoriesListHandler(c *gin.Context) {
+	params, err := ParseListParams(c, advisoryAttrs, "id", "am.id", "am.name", "am.synopsis")
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// only advisories applicable to some of account systems are listed
+	query := advisoriesQuery(database.Db, c.GetString(middlewares.KeyAccount)).Where("ac.advisory_id IS NOT NULL")
+	if format := exportFormat(c); format != "" {
+		var row advisoryRow
+		exportList(c, format, params, query, &row, func() interface{} { return row.item() })
+		return
+	}
+	query, total, err := params.Apply(query)
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load advisories")
+		return
+	}
+	var rows []advisoryRow
+	err = query.Scan(&rows).Error
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load advisories")
+		return
+	}
+
+	data := make([]AdvisoryItem, len(rows))
+	for i := range rows {
+		data[i] = rows[i].item()
+	}
+	c.JSON(http.StatusOK, AdvisoriesResponse{Data: data, Meta: params.Meta(total), Links: params.Links(total)})
+}
+
+func AdvisoryDetailHandler(c *gin.Context) {
+	var rows []advisoryRow
+	err := advisoriesQuery(database.Db, c.GetString(middlewares.KeyAccount)).Where("am.name = ?", c.Param("id")).Scan(&rows).Error
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load advisory")
+		return
+	}
+	if len(rows) == 0 {
+		abortWithError(c, http.StatusNotFound, "advisory not found")
+		return
+	}
+	advisory := rows[0]
+
+	cves, err := advisoryValues(database.Db, &structures.AdvisoryCveDAO{}, "cve", advisory.ID)
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load advisory cves")
+		return
+	}
+	references, err := advisoryValues(database.Db, &structures.AdvisoryReferenceDAO{}, "reference", advisory.ID)
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load advisory references")
+		return
+	}
+	versions, err := advisoryValues(database.Db, &structures.AdvisoryReleaseVersionDAO{}, "release_version",
+		advisory.ID)
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load advisory release versions")
+		return
+	}
+	packages, err := advisoryPackages(database.Db, advisory.ID)
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load advisory packages")
+		return
+	}
+
+	c.JSON(http.StatusOK, AdvisoryDetailResponse{Data: AdvisoryDetailItem{ID: advisory.Name, Type: "advisory",
+		Attributes: AdvisoryDetailAttributes{
+			AdvisoryItemAttributes: advisory.attributes(),
+			Solution:               advisory.Solution,
+			URL:                    advisory.URL,
+			Cves:                   cves,
+			Packages:               packages,
+			References:             references,
+			ReleaseVersions:        versions,
+		}}})
+}
+
+// sorted column values of advisory rows in model table
+func advisoryValues(tx *gorm.DB, model interface{}, column string, advisoryID int) ([]string, error) {
+	values := []string{}
+	err := tx.Model(model).Where("advisory_id = ?", advisoryID).Order(column).Pluck(column, &values).Error
+	return values, err
+}
+
+// account systems the advisory is currently applicable to
+func AdvisorySystemsHandler(c *gin.Context) {
+	params, err := ParseListParams(c, systemAttrs, "id", "hosts.id", "inventory_id", "display_name")
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	var ids []int
+	err = database.Db.Model(&structures.AdvisoryMetadataDAO{}).Where("name = ?", c.Param("id")).
+		Pluck("id", &ids).Error
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load advisory")
+		return
+	}
+	if len(ids) == 0 {
+		abortWithError(c, http.StatusNotFound, "advisory not found")
+		return
+	}
+
+	query := systemsQuery(database.Db, c.GetString(middlewares.KeyAccount)).
+		Joins("JOIN system_advisories sa ON sa.system_id = hosts.id").
+		Where("sa.advisory_id = ? AND sa.when_patched IS NULL", ids[0])
+	if format := exportFormat(c); format != "" {
+		var row systemRow
+		exportList(c, format, params, query, &row, func() interface{} { return row.item() })
+		return
+	}
+	query, total, err := params.Apply(query)
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load advisory systems")
+		return
+	}
+	var rows []systemRow
+	err = query.Scan(&rows).Error
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load advisory systems")
+		return
+	}
+
+	data := make([]SystemItem, len(rows))
+	for i := range rows {
+		data[i] = rows[i].item()
+	}
+	c.JSON(http.StatusOK, SystemsResponse{Data: data, Meta: params.Meta(total), Links: params.Links(total)})
+}
+
+// nevras of packages fixed by advisory, sorted
+func advisoryPackages(tx *gorm.DB, advisoryID int) ([]string, error) {
+	var rows []struct {
+		Name    string
+		Epoch   int
+		Version string
+		Release string
+		Arch    string
+	}
+	err := tx.Table("advisory_package ap").
+		Select("pn.name, p.epoch, p.version, p.release, p.arch").
+		Joins("JOIN package p ON p.id = ap.package_id").
+		Joins("JOIN package_name pn ON pn.id = p.name_id").
+		Where("ap.advisory_id = ?", advisoryID).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	nevras := make([]*utils.Nevra, len(rows))
+	for i, row := range rows {
+		nevras[i] = utils.NewNevra(row.Name, row.Epoch, row.Version, row.Release, row.Arch)
+	}
+	utils.SortNevras(nevras)
+	res := make([]string, len(nevras))
+	for i, nevra := range nevras {
+		res[i] = nevra.String()
+	}
+	return res, nil
+}
+
+func packageNevra(name string, epoch int, version, release, arch string) string {
+	return utils.NewNevra(name, epoch, version, release, arch).String()
+}
+
+// "epoch:version-release.arch", epoch is always included like in vmaas updates
+func packageEVRA(epoch int, version, release, arch string) string {
+	return fmt.Sprintf("%d:%s-%s.%s", epoch, version, release, arch)
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"app/base/core"
+	"app/base/database"
+	"app/base/structures"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func createTestingAdvisory(t *testing.T, name, advisoryType string, packages ...string) int {
+	advisory := structures.AdvisoryMetadataDAO{Name: name, AdvisoryType: advisoryType, Synopsis: "synopsis " + name,
+		Description: "description", Solution: "update", Issued: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Updated: time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)}
+	assert.Nil(t, database.Db.Create(&advisory).Error)
+	ids, err := database.GetOrCreatePackages(database.Db, packages)
+	assert.Nil(t, err)
+	for _, id := range ids {
+		assert.Nil(t, database.Db.Create(&structures.AdvisoryPackageDAO{AdvisoryID: advisory.ID, PackageID: id}).Error)
+	}
+	return advisory.ID
+}
+
+func TestAdvisoriesList(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+	createTestingSample(2)
+	createTestingSampleAccount(3, "0000002")
+	sec := createTestingAdvisory(t, "RHSA-2019:0001", "security")
+	createTestingAdvisory(t, "RHBA-2019:0002", "bugfix")
+	now := time.Now()
+	assert.Nil(t, database.Db.Create(&structures.SystemAdvisoriesDAO{SystemID: 1, AdvisoryID: sec,
+		FirstReported: now}).Error)
+	// other account and patched ones are not counted
+	assert.Nil(t, database.Db.Create(&structures.SystemAdvisoriesDAO{SystemID: 3, AdvisoryID: sec,
+		FirstReported: now}).Error)
+	assert.Nil(t, database.Db.Create(&structures.SystemAdvisoriesDAO{SystemID: 2, AdvisoryID: sec,
+		FirstReported: now, WhenPatched: &now}).Error)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	initRouter(AdvisoriesListHandler).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output AdvisoriesResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	// advisories not applicable to any account system are not listed
+	assert.Equal(t, 1, len(output.Data))
+	assert.Equal(t, "RHSA-2019:0001", output.Data[0].ID)
+	assert.Equal(t, "advisory", output.Data[0].Type)
+	assert.Equal(t, "security", output.Data[0].Attributes.AdvisoryType)
+	assert.Equal(t, "synopsis RHSA-2019:0001", output.Data[0].Attributes.Synopsis)
+	assert.Equal(t, 1, output.Data[0].Attributes.ApplicableSystems)
+	assert.Equal(t, 2019, output.Data[0].Attributes.PublicDate.Year())
+}
+
+func TestAdvisoriesListFilter(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+	createTestingAdvisory(t, "RHBA-2019:0002", "bugfix")
+	sec := createTestingAdvisory(t, "RHSA-2019:0001", "security")
+	assert.Nil(t, database.Db.Create(&structures.SystemAdvisoriesDAO{SystemID: 1, AdvisoryID: sec,
+		FirstReported: time.Now()}).Error)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?sort=-applicable_systems&filter[applicable_systems]=geq:1", nil)
+	initRouter(AdvisoriesListHandler).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output AdvisoriesResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.Equal(t, 1, output.Meta.Total)
+	assert.Equal(t, "RHSA-2019:0001", output.Data[0].ID)
+}
+
+func TestAdvisoryDetail(t *testing.T) {
+	core.SetupTestEnvironment()
+	id := createTestingAdvisory(t, "RHSA-2019:0001", "security", "bash-4.2.46-35.el7.x86_64",
+		"bash-1:4.2.46-35.el7.i686")
+	assert.Nil(t, database.Db.Create(&structures.AdvisoryCveDAO{AdvisoryID: id, Cve: "CVE-2019-2"}).Error)
+	assert.Nil(t, database.Db.Create(&structures.AdvisoryCveDAO{AdvisoryID: id, Cve: "CVE-2019-1"}).Error)
+	assert.Nil(t, database.Db.Create(&structures.AdvisoryReferenceDAO{AdvisoryID: id, Reference: "1700001"}).Error)
+	assert.Nil(t, database.Db.Create(&structures.AdvisoryReleaseVersionDAO{AdvisoryID: id,
+		ReleaseVersion: "7.7"}).Error)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/RHSA-2019:0001", nil)
+	initRouterWithPath(AdvisoryDetailHandler, "/:id").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output AdvisoryDetailResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.Equal(t, "RHSA-2019:0001", output.Data.ID)
+	assert.Equal(t, "update", output.Data.Attributes.Solution)
+	assert.Equal(t, []string{"CVE-2019-1", "CVE-2019-2"}, output.Data.Attributes.Cves)
+	assert.Equal(t, []string{"bash-4.2.46-35.el7.x86_64", "bash-1:4.2.46-35.el7.i686"},
+		output.Data.Attributes.Packages)
+	assert.Equal(t, []string{"1700001"}, output.Data.Attributes.References)
+	assert.Equal(t, []string{"7.7"}, output.Data.Attributes.ReleaseVersions)
+	assert.Equal(t, 0, output.Data.Attributes.ApplicableSystems)
+}
+
+func TestAdvisoryDetailNotFound(t *testing.T) {
+	core.SetupTestEnvironment()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/RHSA-2019:0001", nil)
+	initRouterWithPath(AdvisoryDetailHandler, "/:id").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":{"status":404,"title":"Not Found","detail":"advisory not found"}}`, w.Body.String())
+}
+
+func TestAdvisorySystems(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+	createTestingSample(2)
+	createTestingSample(3)
+	createTestingSampleAccount(4, "0000002")
+	id := createTestingAdvisory(t, "RHSA-2019:0001", "security")
+	now := time.Now()
+	for _, system := range []int{1, 3, 4} {
+		assert.Nil(t, database.Db.Create(&structures.SystemAdvisoriesDAO{SystemID: system, AdvisoryID: id,
+			FirstReported: now}).Error)
+	}
+	assert.Nil(t, database.Db.Create(&structures.SystemAdvisoriesDAO{SystemID: 2, AdvisoryID: id,
+		FirstReported: now, WhenPatched: &now}).Error)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/RHSA-2019:0001/systems?sort=-id", nil)
+	initRouterWithPath(AdvisorySystemsHandler, "/:id/systems").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output SystemsResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.Equal(t, 2, output.Meta.Total)
+	assert.Equal(t, "INV-3", output.Data[0].ID)
+	assert.Equal(t, "INV-1", output.Data[1].ID)
+	assert.Equal(t, "system", output.Data[1].Type)
+}
+
+func TestAdvisorySystemsNotFound(t *testing.T) {
+	core.SetupTestEnvironment()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/RHSA-2019:0001/systems", nil)
+	initRouterWithPath(AdvisorySystemsHandler, "/:id/systems").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"app/base/utils"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// abort request with error envelope
+func abortWithError(c *gin.Context, status int, detail string) {
+	utils.AbortWithError(c, status, detail)
+}
+
+// log internal error, its details are not exposed to client
+func abortWithInternalError(c *gin.Context, err error, detail string) {
+	utils.Log("err", err.Error()).Error(detail)
+	abortWithError(c, http.StatusInternalServerError, detail)
+}
+
+func NotFoundHandler(c *gin.Context) {
+	abortWithError(c, http.StatusNotFound, "resource not found")
+}
+
+func MethodNotAllowedHandler(c *gin.Context) {
+	abortWithError(c, http.StatusMethodNotAllowed, "method not allowed")
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"app/base/database"
+	"app/base/utils"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	mimeCSV    = "text/csv"
+	mimeNDJSON = "application/x-ndjson"
+)
+
+// export format requested by Accept header, empty for JSON response
+// the first supported media type wins, parameters and quality values are ignored
+func exportFormat(c *gin.Context) string {
+	for _, item := range strings.Split(c.GetHeader("Accept"), ",") {
+		switch mediaType := strings.TrimSpace(strings.SplitN(item, ";", 2)[0]); mediaType {
+		case mimeCSV, mimeNDJSON:
+			return mediaType
+		case "application/json", "application/*", "*/*":
+			return ""
+		}
+	}
+	return ""
+}
+
+// whether request is list export, exports are streamed and must not be buffered by compression
+func IsExportRequest(c *gin.Context) bool {
+	return exportFormat(c) != ""
+}
+
+// exported column, "id" of item or json name of item attribute
+type exportColumn struct {
+	name string
+	// index of attribute in item Attributes, nil for id
+	index []int
+}
+
+// columns of api list item, which has ID and Attributes fields
+func exportColumns(item interface{}) []exportColumn {
+	columns := []exportColumn{{name: "id"}}
+	attributes, _ := reflect.TypeOf(item).FieldByName("Attributes")
+	return appendAttrColumns(columns, attributes.Type, nil)
+}
+
+func appendAttrColumns(columns []exportColumn, attrType reflect.Type, prefix []int) []exportColumn {
+	for i := 0; i < attrType.NumField(); i++ {
+		field := attrType.Field(i)
+		index := append(append([]int{}, prefix...), i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			columns = appendAttrColumns(columns, field.Type, index)
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			columns = append(columns, exportColumn{name: name, index: index})
+		}
+	}
+	return columns
+}
+
+// columns listed in comma separated fields parameter, all when it's missing
+func selectColumns(columns []exportColumn, fields string) ([]exportColumn, error) {
+	if fields == "" {
+		return columns, nil
+	}
+	var selected []exportColumn
+	for _, name := range strings.Split(fields, ",") {
+		found := false
+		for _, column := range columns {
+			if column.name == name {
+				selected = append(selected, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid field '%s'", name)
+		}
+	}
+	return selected, nil
+}
+
+// column values of item, nil pointers are nil
+func exportValues(item interface{}, columns []exportColumn) []interface{} {
+	value := reflect.ValueOf(item)
+	attributes := value.FieldByName("Attributes")
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		if column.index == nil {
+			values[i] = value.FieldByName("ID").Interface()
+			continue
+		}
+		field := attributes.FieldByIndex(column.index)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		values[i] = field.Interface()
+	}
+	return values
+}
+
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type exportWriter interface {
+	header(columns []exportColumn) error
+	row(columns []exportColumn, values []interface{}) error
+	// trailing record of export which failed after its start
+	fail(detail string) error
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvExportWriter) header(columns []exportColumn) error {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+	}
+	return w.write(names)
+}
+
+func (w *csvExportWriter) row(columns []exportColumn, values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = csvValue(value)
+	}
+	return w.write(record)
+}
+
+// single field record, readers checking field counts reject it even when there are other rows
+func (w *csvExportWriter) fail(detail string) error {
+	return w.write([]string{"error: " + detail})
+}
+
+func (w *csvExportWriter) write(record []string) error {
+	err := w.writer.Write(record)
+	if err != nil {
+		return err
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// one JSON object per line
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonExportWriter) header(columns []exportColumn) error {
+	return nil
+}
+
+func (w *ndjsonExportWriter) row(columns []exportColumn, values []interface{}) error {
+	object := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		object[column.name] = values[i]
+	}
+	return w.encoder.Encode(object)
+}
+
+// error envelope of api endpoints
+func (w *ndjsonExportWriter) fail(detail string) error {
+	status := http.StatusInternalServerError
+	return w.encoder.Encode(utils.ErrorResponse{Error: utils.ErrorDetail{Status: status,
+		Title: http.StatusText(status), Detail: detail}})
+}
+
+// stream all filtered rows of sorted query in given format, limit and offset are not applied
+// each database row is scanned into row and converted by item to api list item
+func exportList(c *gin.Context, format string, params *ListParams, query *gorm.DB, row interface{},
+	item func() interface{}) {
+	columns, err := selectColumns(exportColumns(item()), c.Query("fields"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	rows, err := params.Order(params.Filter(query)).Rows()
+	if err != nil {
+		abortWithInternalError(c, err, "unable to export list")
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", format+"; charset=utf-8")
+	c.Status(http.StatusOK)
+	var writer exportWriter = &ndjsonExportWriter{encoder: json.NewEncoder(c.Writer)}
+	if format == mimeCSV {
+		writer = &csvExportWriter{writer: csv.NewWriter(c.Writer)}
+	}
+	err = writer.header(columns)
+	rowValue := reflect.ValueOf(row).Elem()
+	for err == nil && rows.Next() {
+		// nulls don't overwrite values of previous row
+		rowValue.Set(reflect.Zero(rowValue.Type()))
+		err = database.Db.ScanRows(rows, row)
+		if err == nil {
+			err = writer.row(columns, exportValues(item(), columns))
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		// status is already sent, trailing error record tells client the export is incomplete
+		utils.Log("err", err.Error()).Error("unable to export list")
+		err = writer.fail("unable to export list")
+		if err != nil {
+			utils.Log("err", err.Error()).Error("unable to write export error")
+		}
+		c.Abort()
+		c.Writer.Flush()
+		return
+	}
+	c.Writer.Flush()
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"app/base/core"
+	"app/base/database"
+	"app/base/structures"
+	"bufio"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func exportRequest(handler gin.HandlerFunc, path, url, accept string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Accept", accept)
+	initRouterWithPath(handler, path).ServeHTTP(w, req)
+	return w
+}
+
+func TestExportFormat(t *testing.T) {
+	for accept, format := range map[string]string{
+		"":                                    "",
+		"text/csv":                            mimeCSV,
+		"application/x-ndjson; charset=utf-8": mimeNDJSON,
+		"text/html, text/csv;q=0.9":           mimeCSV,
+		"application/json, text/csv":          "",
+		"*/*":                                 "",
+		"application/json-patch+json, text/x": "",
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("Accept", accept)
+		assert.Equal(t, format, exportFormat(c), accept)
+	}
+}
+
+func TestExportSystemsCSV(t *testing.T) {
+	core.SetupTestEnvironment()
+	for id := 1; id <= 25; id++ {
+		createTestingSample(id)
+	}
+	evaluated := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Nil(t, database.Db.Model(&structures.HostDAO{}).Where("id = ?", 10).
+		Updates(map[string]interface{}{"display_name": "web, \"prod\"", "last_evaluation": evaluated}).Error)
+
+	w := exportRequest(SystemsListHandler, "/", "/?fields=id,display_name,last_evaluation,opt_out&sort=id",
+		"text/csv")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	scanner := bufio.NewScanner(w.Body)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	// all rows are exported regardless of page size
+	assert.Equal(t, 26, len(lines))
+	assert.Equal(t, "id,display_name,last_evaluation,opt_out", lines[0])
+	assert.Equal(t, "INV-1,,,false", lines[1])
+	assert.Equal(t, `INV-10,"web, ""prod""",2019-01-02T03:04:05Z,false`, lines[2])
+}
+
+func TestExportAdvisoriesNDJSON(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+	for _, name := range []string{"RHSA-2019:0001", "RHBA-2019:0002"} {
+		id := createTestingAdvisory(t, name, "security")
+		assert.Nil(t, database.Db.Create(&structures.SystemAdvisoriesDAO{SystemID: 1, AdvisoryID: id,
+			FirstReported: time.Now()}).Error)
+	}
+
+	w := exportRequest(AdvisoriesListHandler, "/", "/?filter[id]=neq:RHBA-2019:0002", "application/x-ndjson")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson; charset=utf-8", w.Header().Get("Content-Type"))
+	decoder := json.NewDecoder(w.Body)
+	var row map[string]interface{}
+	assert.Nil(t, decoder.Decode(&row))
+	assert.Equal(t, "RHSA-2019:0001", row["id"])
+	assert.Equal(t, "security", row["advisory_type"])
+	assert.Nil(t, row["severity"])
+	assert.Equal(t, float64(1), row["applicable_systems"])
+	assert.Equal(t, "2019-01-01T00:00:00Z", row["public_date"])
+	assert.False(t, decoder.More())
+}
+
+func TestExportPackageSystems(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingPackageSystems(t)
+
+	w := exportRequest(PackageSystemsHandler, "/:name/systems", "/openssl/systems?fields=id,evra&sort=-evr",
+		"text/csv")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "id,evra\nINV-1,1:1.0.2k-19.el7.x86_64\nINV-3,1:1.0.2k-16.el7.x86_64\n"+
+		"INV-2,1:1.0.2k-8.el7.x86_64\n", w.Body.String())
+}
+
+func TestExportInvalidFields(t *testing.T) {
+	core.SetupTestEnvironment()
+
+	w := exportRequest(SystemsListHandler, "/", "/?fields=id,checksum", "text/csv")
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":{"status":400,"title":"Bad Request","detail":"invalid field 'checksum'"}}`,
+		w.Body.String())
+}
+
+type failingExportItem struct {
+	ID         string
+	Attributes struct {
+		Value int `json:"value"`
+	}
+}
+
+// the second host has value which can't be scanned
+func failingExport(accept string) *httptest.ResponseRecorder {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+	createTestingSample(2)
+	database.Db.Model(&structures.HostDAO{}).Where("id = ?", 1).Update("display_name", "1")
+	database.Db.Model(&structures.HostDAO{}).Where("id = ?", 2).Update("display_name", "x")
+
+	handler := func(c *gin.Context) {
+		attrs := attrMap{"id": {"h.inventory_id", attrString}}
+		params, _ := ParseListParams(c, attrs, "id", "h.id")
+		query := database.Db.Table("hosts h").Select("h.inventory_id AS id, h.display_name AS value")
+		var row struct {
+			ID    string
+			Value int
+		}
+		exportList(c, exportFormat(c), params, query, &row, func() interface{} {
+			var item failingExportItem
+			item.ID, item.Attributes.Value = row.ID, row.Value
+			return item
+		})
+	}
+	return exportRequest(handler, "/", "/", accept)
+}
+
+func TestExportFailedCSV(t *testing.T) {
+	w := failingExport("text/csv")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "id,value\nINV-1,1\nerror: unable to export list\n", w.Body.String())
+}
+
+func TestExportFailedNDJSON(t *testing.T) {
+	w := failingExport("application/x-ndjson")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"id":"INV-1","value":1}`+"\n"+
+		`{"error":{"status":500,"title":"Internal Server Error","detail":"unable to export list"}}`+"\n",
+		w.Body.String())
+}
@@ -1,56 +1,321 @@
 package controllers
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"app/base/database"
-	"app/base/structures"
 	"app/base/utils"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
-	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func ListHandler(c *gin.Context) {
-	var records []structures.HostDAO
-	err := database.Db.Model(&structures.HostDAO{}).Order("id DESC").Find(&records).Error
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"err":  err.Error()})
-		return
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+type attrKind int
+
+const (
+	attrString attrKind = iota
+	attrInt
+	attrBool
+	attrTime
+	// rpm "[epoch:]version-release", compared by rpm rules outside of SQL, see ListParams.MatchEVR
+	attrEVR
+)
+
+// list attribute which can be used in sort and filter parameters
+type attribute struct {
+	// SQL expression, never taken from request
+	expr string
+	kind attrKind
+}
+
+// allowlist of sortable and filterable attributes by their api name
+type attrMap map[string]attribute
+
+// comparison operators usable in filter[attr]=op:value, value without known operator means "eq"
+var filterOperators = map[string]string{
+	"eq":  "%s = ?",
+	"neq": "%s <> ?",
+	"gt":  "%s > ?",
+	"lt":  "%s < ?",
+	"geq": "%s >= ?",
+	"leq": "%s <= ?",
+	"in":  "%s IN (?)",
+	// case insensitive substring match, string attributes only
+	"contains": "LOWER(%s) LIKE ? ESCAPE '\\'",
+}
+
+type ListMeta struct {
+	Total  int               `json:"total"`
+	Limit  int               `json:"limit"`
+	Offset int               `json:"offset"`
+	Sort   []string          `json:"sort"`
+	Filter map[string]string `json:"filter"`
+	Search string            `json:"search,omitempty"`
+}
+
+// links to pages of the same list, prev and next are null on the first and the last page
+type Links struct {
+	First string  `json:"first"`
+	Prev  *string `json:"prev"`
+	Next  *string `json:"next"`
+	Last  string  `json:"last"`
+}
+
+type filter struct {
+	attr     string
+	operator string
+	value    interface{}
+}
+
+// parsed limit, offset, sort and filter parameters of list request
+type ListParams struct {
+	Limit   int
+	Offset  int
+	Sort    []string
+	Filters []filter
+	// case insensitive substring searched in searchExprs
+	Search      string
+	searchExprs []string
+	attrs       attrMap
+	// appended to order, so pages are stable
+	tiebreaker string
+	url        url.URL
+}
+
+// parse list parameters, sort and filter attributes are checked against allowlist
+// defaultSort is used when there is no sort parameter, tiebreaker orders rows with equal sort attributes
+// search parameter is allowed only when there are expressions to search in
+func ParseListParams(c *gin.Context, attrs attrMap, defaultSort, tiebreaker string,
+	searchExprs ...string) (*ListParams, error) {
+	params := ListParams{attrs: attrs, tiebreaker: tiebreaker, url: *c.Request.URL, searchExprs: searchExprs,
+		Search: c.Query("search")}
+	if params.Search != "" && len(searchExprs) == 0 {
+		return nil, errors.New("search is not supported")
+	}
+	var err error
+	params.Limit, err = utils.LoadParamInt(c, "limit", defaultLimit, true)
+	if err != nil || params.Limit < 1 || params.Limit > maxLimit {
+		return nil, fmt.Errorf("invalid limit, expected number between 1 and %d", maxLimit)
+	}
+	params.Offset, err = utils.LoadParamInt(c, "offset", 0, true)
+	if err != nil || params.Offset < 0 {
+		return nil, errors.New("invalid offset, expected non-negative number")
 	}
 
-	c.JSON(http.StatusOK, &records)
-	return
+	sortParam := c.DefaultQuery("sort", defaultSort)
+	for _, item := range strings.Split(sortParam, ",") {
+		if _, ok := attrs[strings.TrimPrefix(item, "-")]; !ok {
+			return nil, fmt.Errorf("invalid sort attribute '%s'", item)
+		}
+		params.Sort = append(params.Sort, item)
+	}
+
+	for name, value := range c.QueryMap("filter") {
+		f, err := parseFilter(attrs, name, value)
+		if err != nil {
+			return nil, err
+		}
+		params.Filters = append(params.Filters, *f)
+	}
+	// deterministic query and meta
+	sort.Slice(params.Filters, func(i, j int) bool {
+		return params.Filters[i].attr < params.Filters[j].attr
+	})
+	return &params, nil
 }
 
-func GetHostHandler(c *gin.Context) {
-	id, err := utils.LoadParamInt(c, "id", 0, false)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "wrong param 'id' value"})
-		return
+func parseFilter(attrs attrMap, name, value string) (*filter, error) {
+	attr, ok := attrs[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid filter attribute '%s'", name)
+	}
+	operator := "eq"
+	if parts := strings.SplitN(value, ":", 2); len(parts) == 2 {
+		if _, ok := filterOperators[parts[0]]; ok {
+			operator, value = parts[0], parts[1]
+		}
 	}
 
-	var host structures.HostDAO
-	err = database.Db.Where(&structures.HostDAO{ID: id}).First(&host).Error
-	if err != nil {
-		if gorm.IsRecordNotFoundError(err) {
-			c.JSON(http.StatusNotFound, gin.H{"err":  err.Error()})
-			return
+	switch {
+	case operator == "contains":
+		if attr.kind != attrString {
+			return nil, fmt.Errorf("filter operator 'contains' can't be used for '%s'", name)
+		}
+		return &filter{attr: name, operator: operator, value: likePattern(value)}, nil
+	case operator == "in":
+		var values []interface{}
+		for _, item := range strings.Split(value, ",") {
+			converted, err := convertValue(attr.kind, item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter value of '%s': %s", name, err.Error())
+			}
+			values = append(values, converted)
+		}
+		return &filter{attr: name, operator: operator, value: values}, nil
+	default:
+		converted, err := convertValue(attr.kind, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter value of '%s': %s", name, err.Error())
+		}
+		return &filter{attr: name, operator: operator, value: converted}, nil
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// lowercase pattern matching values which contain given one, wildcards in value are matched literally
+func likePattern(value string) string {
+	return "%" + likeEscaper.Replace(strings.ToLower(value)) + "%"
+}
+
+// typed query parameter, comparisons behave the same in PostgreSQL and SQLite
+func convertValue(kind attrKind, value string) (interface{}, error) {
+	switch kind {
+	case attrInt:
+		return strconv.Atoi(value)
+	case attrBool:
+		return strconv.ParseBool(value)
+	case attrTime:
+		return time.Parse(time.RFC3339, value)
+	case attrEVR:
+		evr, err := utils.ParseEVR(value)
+		if err != nil {
+			return nil, err
+		}
+		return *evr, nil
+	default:
+		return value, nil
+	}
+}
+
+// apply filters and search to query, evr filters are left to caller
+func (p *ListParams) Filter(query *gorm.DB) *gorm.DB {
+	for _, f := range p.Filters {
+		if p.attrs[f.attr].kind == attrEVR {
+			continue
+		}
+		query = query.Where(fmt.Sprintf(filterOperators[f.operator], p.attrs[f.attr].expr), f.value)
+	}
+	if p.Search != "" {
+		conditions := make([]string, len(p.searchExprs))
+		values := make([]interface{}, len(p.searchExprs))
+		for i, expr := range p.searchExprs {
+			conditions[i] = "LOWER(" + expr + ") LIKE ? ESCAPE '\\'"
+			values[i] = likePattern(p.Search)
+		}
+		query = query.Where(strings.Join(conditions, " OR "), values...)
+	}
+	return query
+}
+
+// whether evr satisfies all filters of given evr attribute
+func (p *ListParams) MatchEVR(attr string, evr utils.EVR) bool {
+	for _, f := range p.Filters {
+		if f.attr == attr && !matchEVR(f.operator, evr, f.value) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchEVR(operator string, evr utils.EVR, value interface{}) bool {
+	if operator == "in" {
+		for _, item := range value.([]interface{}) {
+			if evr.Compare(item.(utils.EVR)) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	cmp := evr.Compare(value.(utils.EVR))
+	switch operator {
+	case "neq":
+		return cmp != 0
+	case "gt":
+		return cmp > 0
+	case "lt":
+		return cmp < 0
+	case "geq":
+		return cmp >= 0
+	case "leq":
+		return cmp <= 0
+	default:
+		return cmp == 0
+	}
+}
+
+// apply order to query, rows with equal sort attributes are ordered by tiebreaker
+func (p *ListParams) Order(query *gorm.DB) *gorm.DB {
+	for _, item := range p.Sort {
+		if strings.HasPrefix(item, "-") {
+			query = query.Order(p.attrs[item[1:]].expr + " DESC")
+		} else {
+			query = query.Order(p.attrs[item].expr + " ASC")
 		}
+	}
+	return query.Order(p.tiebreaker)
+}
+
+// apply order, limit and offset to query
+func (p *ListParams) Page(query *gorm.DB) *gorm.DB {
+	return p.Order(query).Limit(p.Limit).Offset(p.Offset)
+}
+
+// apply filters and count matching rows, then apply paging, query has to be ready for count
+func (p *ListParams) Apply(query *gorm.DB) (*gorm.DB, int, error) {
+	query = p.Filter(query)
+	var total int
+	err := query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return p.Page(query), total, nil
+}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"err":  err.Error()})
-		return
+func (p *ListParams) Meta(total int) ListMeta {
+	meta := ListMeta{Total: total, Limit: p.Limit, Offset: p.Offset, Sort: p.Sort, Filter: map[string]string{},
+		Search: p.Search}
+	for name, value := range p.url.Query() {
+		if strings.HasPrefix(name, "filter[") && strings.HasSuffix(name, "]") {
+			meta.Filter[name[len("filter["):len(name)-1]] = value[0]
+		}
 	}
+	return meta
+}
 
-	// check checksum
-	cont := []byte(host.Request)
-	bytes := sha256.Sum256(cont)
-	computedChecksum := hex.EncodeToString(bytes[:])
-	if computedChecksum != host.Checksum {
-		c.JSON(http.StatusPartialContent, gin.H{"message": "wrong checksum"})
-		return
+func (p *ListParams) Links(total int) Links {
+	last := 0
+	if total > 0 {
+		last = (total - 1) / p.Limit * p.Limit
 	}
+	links := Links{First: p.pageLink(0), Last: p.pageLink(last)}
+	if p.Offset > 0 {
+		prev := p.Offset - p.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		link := p.pageLink(prev)
+		links.Prev = &link
+	}
+	if p.Offset+p.Limit < total {
+		link := p.pageLink(p.Offset + p.Limit)
+		links.Next = &link
+	}
+	return links
+}
 
-	c.JSON(http.StatusOK, &host)
-	return
+// request path and query with given offset
+func (p *ListParams) pageLink(offset int) string {
+	query := p.url.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(p.Limit))
+	return p.url.Path + "?" + query.Encode()
 }
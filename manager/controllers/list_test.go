@@ -2,55 +2,99 @@ package controllers
 
 import (
 	"app/base/core"
-	"github.com/bitly/go-simplejson"
+	"app/base/database"
+	"app/base/structures"
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 )
 
+var testAttrs = attrMap{
+	"id":    {"inventory_id", attrString},
+	"name":  {"display_name", attrString},
+	"count": {"advisory_count_cache", attrInt},
+	"flag":  {"opt_out", attrBool},
+}
 
-func TestList(t *testing.T) {
-	core.SetupTestEnvironment()
-
-	createTestingSample(1)
-	createTestingSample(2)
-
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/", nil)
-	initRouter(ListHandler).ServeHTTP(w, req)
-
-	assert.Equal(t, http.StatusOK, w.Code)
+func parseTestParams(query string) (*ListParams, error) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/list?"+query, nil)
+	return ParseListParams(c, testAttrs, "id", "id")
+}
 
-	js, err := simplejson.NewJson([]byte(w.Body.String()))
+func TestParseListParamsDefaults(t *testing.T) {
+	params, err := parseTestParams("")
 	assert.Nil(t, err)
+	assert.Equal(t, defaultLimit, params.Limit)
+	assert.Equal(t, 0, params.Offset)
+	assert.Equal(t, []string{"id"}, params.Sort)
+	assert.Equal(t, 0, len(params.Filters))
+}
 
-	pkgs, err := js.Array()
-	assert.Equal(t, 2, len(pkgs))
+func TestParseListParams(t *testing.T) {
+	params, err := parseTestParams("limit=5&offset=10&sort=-count,name&filter[name]=contains:Web" +
+		"&filter[count]=in:1,2&filter[id]=INV-1:2")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, params.Limit)
+	assert.Equal(t, 10, params.Offset)
+	assert.Equal(t, []string{"-count", "name"}, params.Sort)
+	assert.Equal(t, []filter{
+		{attr: "count", operator: "in", value: []interface{}{1, 2}},
+		// unknown operator is part of value
+		{attr: "id", operator: "eq", value: "INV-1:2"},
+		{attr: "name", operator: "contains", value: "%web%"},
+	}, params.Filters)
 }
 
-func TestGetHostOK(t *testing.T) {
-	core.SetupTestEnvironment()
+func TestParseListParamsInvalid(t *testing.T) {
+	for _, query := range []string{"limit=x", "limit=101", "offset=-1", "sort=checksum", "sort=id%3Bdrop",
+		"filter[checksum]=1", "filter[count]=contains:1", "filter[count]=1.5", "filter[flag]=maybe"} {
+		_, err := parseTestParams(query)
+		assert.NotNil(t, err, query)
+	}
+}
 
-	createTestingSample(1)
+func TestParseListParamsSearch(t *testing.T) {
+	_, err := parseTestParams("search=web")
+	assert.Equal(t, "search is not supported", err.Error())
 
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/1", nil)
-	initRouterWithPath(GetHostHandler, "/:id").ServeHTTP(w, req)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/list?search=We_b", nil)
+	params, err := ParseListParams(c, testAttrs, "id", "id", "inventory_id", "display_name")
+	assert.Nil(t, err)
+	assert.Equal(t, "We_b", params.Meta(0).Search)
+}
 
-	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, `{"id":1,"request":"r","checksum":"454349e422f05297191ead13e21d3db520e5abef52055e4964b82fb213f593a1","updated":"0001-01-01T00:00:00Z"}`, w.Body.String())
+func TestListParamsLinks(t *testing.T) {
+	params, err := parseTestParams("limit=10&offset=15&sort=name")
+	assert.Nil(t, err)
+	links := params.Links(42)
+	assert.Equal(t, "/list?limit=10&offset=0&sort=name", links.First)
+	assert.Equal(t, "/list?limit=10&offset=5&sort=name", *links.Prev)
+	assert.Equal(t, "/list?limit=10&offset=25&sort=name", *links.Next)
+	assert.Equal(t, "/list?limit=10&offset=40&sort=name", links.Last)
+
+	links = params.Links(20)
+	assert.Nil(t, links.Next)
+	assert.Equal(t, "/list?limit=10&offset=10&sort=name", links.Last)
 }
 
-func TestGetHostNotFound(t *testing.T) {
+func TestListParamsApply(t *testing.T) {
 	core.SetupTestEnvironment()
+	for i := 1; i <= 3; i++ {
+		createTestingSample(i)
+	}
+	assert.Nil(t, database.Db.Model(&structures.HostDAO{ID: 2}).Update("opt_out", true).Error)
 
-	createTestingSample(1)
-
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/100", nil)
-	initRouterWithPath(GetHostHandler, "/:id").ServeHTTP(w, req)
-
-	assert.Equal(t, http.StatusNotFound, w.Code)
-	assert.Equal(t, `{"err":"record not found"}`, w.Body.String())
+	params, err := parseTestParams("filter[flag]=false&sort=-id&limit=1")
+	assert.Nil(t, err)
+	query, total, err := params.Apply(database.Db.Model(&structures.HostDAO{}))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, total)
+	var hosts []structures.HostDAO
+	assert.Nil(t, query.Find(&hosts).Error)
+	assert.Equal(t, 1, len(hosts))
+	assert.Equal(t, "INV-3", hosts[0].InventoryID)
 }
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"app/base/utils"
+	"app/manager/openapi"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	APIPrefix  = "/api/patch/v1"
+	apiVersion = "1.0.0"
+)
+
+// api operation described by OpenAPI document
+type apiOperation struct {
+	method string
+	// gin route path relative to APIPrefix
+	path    string
+	id      string
+	summary string
+	// request body, nil when operation has none
+	request interface{}
+	status  int
+	// response body, nil for empty response
+	response interface{}
+	// sortable and filterable attributes of list operations
+	listAttrs attrMap
+	// what search parameter of list operation is matched with, see searchExprs of ParseListParams call
+	// empty when search is not supported
+	search string
+	// error statuses besides authentication and authorization ones
+	errors []int
+}
+
+// all api operations, routes registered under APIPrefix have to be listed here
+var apiOperations = []apiOperation{
+	{method: "GET", path: "/systems", id: "listSystems", summary: "Systems of the account with advisory counts",
+		status: http.StatusOK, response: SystemsResponse{}, listAttrs: systemAttrs,
+		search: "inventory id or display name", errors: []int{http.StatusBadRequest}},
+	{method: "GET", path: "/systems/:id", id: "getSystem", summary: "System detail",
+		status: http.StatusOK, response: SystemDetailResponse{}, errors: []int{http.StatusNotFound}},
+	{method: "GET", path: "/systems/:id/advisories", id: "listSystemAdvisories",
+		summary: "Advisories applicable to system", status: http.StatusOK, response: SystemAdvisoriesResponse{},
+		listAttrs: systemAdvisoryAttrs, search: "advisory name or synopsis",
+		errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: "GET", path: "/systems/:id/packages", id: "listSystemPackages",
+		summary: "Packages installed on system with available updates", status: http.StatusOK,
+		response: SystemPackagesResponse{}, listAttrs: systemPackageAttrs, search: "package name",
+		errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: "DELETE", path: "/systems/:id", id: "deleteSystem", summary: "Delete system and its data",
+		status: http.StatusNoContent, errors: []int{http.StatusNotFound}},
+	{method: "PATCH", path: "/systems/:id", id: "updateSystem", summary: "Update system attributes",
+		request: SystemUpdateRequest{}, status: http.StatusOK, response: SystemDetailResponse{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: "GET", path: "/advisories", id: "listAdvisories",
+		summary: "Advisories applicable to account systems with number of these systems",
+		status:  http.StatusOK, response: AdvisoriesResponse{}, listAttrs: advisoryAttrs,
+		search: "advisory name or synopsis", errors: []int{http.StatusBadRequest}},
+	{method: "GET", path: "/advisories/:id", id: "getAdvisory", summary: "Advisory detail with CVEs, packages, references and release versions",
+		status: http.StatusOK, response: AdvisoryDetailResponse{}, errors: []int{http.StatusNotFound}},
+	{method: "GET", path: "/advisories/:id/systems", id: "listAdvisorySystems",
+		summary: "Account systems the advisory is applicable to", status: http.StatusOK,
+		response: SystemsResponse{}, listAttrs: systemAttrs, search: "inventory id or display name",
+		errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: "GET", path: "/packages", id: "listPackages",
+		summary: "Packages installed on account systems with numbers of installed and updatable systems",
+		status:  http.StatusOK, response: PackagesResponse{}, listAttrs: packageAttrs, search: "package name",
+		errors: []int{http.StatusBadRequest}},
+	{method: "GET", path: "/packages/:name/systems", id: "listPackageSystems",
+		summary: "Account systems with installed version of the package", status: http.StatusOK,
+		response: PackageSystemsResponse{}, listAttrs: packageSystemAttrs, search: "inventory id or display name",
+		errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+}
+
+var apiDocument = buildAPIDocument()
+
+// generated OpenAPI document, shared, must not be modified
+func APIDocument() *openapi.Document {
+	return apiDocument
+}
+
+func buildAPIDocument() *openapi.Document {
+	doc := openapi.NewDocument("Patchman engine API", apiVersion, APIPrefix)
+	doc.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		"RhIdentity": {Type: "apiKey", In: "header", Name: "x-rh-identity"},
+	}
+	doc.Security = []map[string][]string{{"RhIdentity": {}}}
+	errorSchema := doc.SchemaOf(utils.ErrorResponse{})
+
+	for _, item := range apiOperations {
+		operation := openapi.Operation{Summary: item.summary, OperationID: item.id,
+			Responses: map[string]*openapi.Response{}}
+		for _, part := range strings.Split(item.path, "/") {
+			if strings.HasPrefix(part, ":") {
+				operation.Parameters = append(operation.Parameters, openapi.Parameter{Name: part[1:], In: "path",
+					Required: true, Schema: &openapi.Schema{Type: "string"}})
+			}
+		}
+		if item.listAttrs != nil {
+			operation.Parameters = append(operation.Parameters, listParameters(item.listAttrs, item.search)...)
+		}
+		if item.request != nil {
+			operation.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+				"application/json": {Schema: doc.SchemaOf(item.request)}}}
+		}
+
+		response := openapi.Response{Description: http.StatusText(item.status)}
+		if item.response != nil {
+			response.Content = map[string]openapi.MediaType{"application/json": {Schema: doc.SchemaOf(item.response)}}
+		}
+		if item.listAttrs != nil {
+			// exports selected by Accept header
+			response.Content[mimeCSV] = openapi.MediaType{Schema: &openapi.Schema{Type: "string"}}
+			response.Content[mimeNDJSON] = openapi.MediaType{Schema: &openapi.Schema{Type: "string"}}
+		}
+		operation.Responses[fmt.Sprint(item.status)] = &response
+		statuses := append([]int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError,
+			http.StatusServiceUnavailable}, item.errors...)
+		for _, status := range statuses {
+			operation.Responses[fmt.Sprint(status)] = &openapi.Response{Description: http.StatusText(status),
+				Content: map[string]openapi.MediaType{"application/json": {Schema: errorSchema}}}
+		}
+		doc.AddOperation(item.method, item.path, &operation)
+	}
+	return doc
+}
+
+// limit, offset, sort, filter, fields and optionally search parameters with allowed attributes
+// search describes what the search parameter is matched with, empty when it's not supported
+func listParameters(attrs attrMap, search string) []openapi.Parameter {
+	var names []string
+	filters := openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{}}
+	for name := range attrs {
+		names = append(names, name)
+		filters.Properties[name] = &openapi.Schema{Type: "string"}
+	}
+	sort.Strings(names)
+	explode := true
+	params := []openapi.Parameter{
+		{Name: "limit", In: "query", Description: fmt.Sprintf("page size, at most %d", maxLimit),
+			Schema: &openapi.Schema{Type: "integer"}},
+		{Name: "offset", In: "query", Schema: &openapi.Schema{Type: "integer"}},
+		{Name: "sort", In: "query", Schema: &openapi.Schema{Type: "string"},
+			Description: "comma separated attributes, '-' prefix for descending order: " + strings.Join(names, ", ")},
+		{Name: "filter", In: "query", Style: "deepObject", Explode: &explode, Schema: &filters,
+			Description: "filter[attribute]=operator:value, operators are eq (default), neq, gt, lt, geq, leq, in " +
+				"(comma separated values) and contains, evr is compared by rpm rules"},
+	}
+	params = append(params, openapi.Parameter{Name: "fields", In: "query", Schema: &openapi.Schema{Type: "string"},
+		Description: "comma separated id and attributes of " + mimeCSV + " and " + mimeNDJSON + " exports, " +
+			"which contain all rows, limit and offset are not applied"})
+	if search != "" {
+		params = append(params, openapi.Parameter{Name: "search", In: "query", Schema: &openapi.Schema{Type: "string"},
+			Description: "case insensitive substring of " + search})
+	}
+	return params
+}
+
+func OpenAPIHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, apiDocument)
+}
+
+// path of swagger ui assets, files of pinned swagger-ui-dist version are served from local directory
+const SwaggerUIAssetsPath = APIPrefix + "/docs/assets"
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Patchman engine API</title>
+  <link rel="stylesheet" href="` + SwaggerUIAssetsPath + `/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="` + SwaggerUIAssetsPath + `/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "` + APIPrefix + `/openapi.json", dom_id: "#swagger-ui"})</script>
+</body>
+</html>
+`
+
+func SwaggerUIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
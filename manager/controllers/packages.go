@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"app/base/database"
+	"app/base/utils"
+	"app/manager/middlewares"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type PackageItem struct {
+	// package name
+	ID         string                `json:"id"`
+	Type       string                `json:"type"`
+	Attributes PackageItemAttributes `json:"attributes"`
+}
+
+type PackageItemAttributes struct {
+	Name string `json:"name"`
+	// account systems with any version of the package installed
+	SystemsInstalled int `json:"systems_installed"`
+	// account systems with update of the package available
+	SystemsUpdatable int `json:"systems_updatable"`
+}
+
+type PackagesResponse struct {
+	Data  []PackageItem `json:"data"`
+	Meta  ListMeta      `json:"meta"`
+	Links Links         `json:"links"`
+}
+
+type PackageSystemItem struct {
+	// inventory id
+	ID         string                      `json:"id"`
+	Type       string                      `json:"type"`
+	Attributes PackageSystemItemAttributes `json:"attributes"`
+}
+
+type PackageSystemItemAttributes struct {
+	DisplayName string `json:"display_name"`
+	// installed "epoch:version-release.arch"
+	EVRA string `json:"evra"`
+	// the latest available update, null when package is up to date
+	LatestEVRA *string `json:"latest_evra"`
+	Updatable  bool    `json:"updatable"`
+}
+
+type PackageSystemsResponse struct {
+	Data  []PackageSystemItem `json:"data"`
+	Meta  ListMeta            `json:"meta"`
+	Links Links               `json:"links"`
+}
+
+// joined to package names, counts systems of the account
+const packageCountsJoin = "JOIN (SELECT p.name_id, count(DISTINCT sp.system_id) AS systems_installed, " +
+	"count(DISTINCT CASE WHEN sp.latest_evra IS NOT NULL THEN sp.system_id END) AS systems_updatable " +
+	"FROM system_package sp JOIN hosts h ON h.id = sp.system_id JOIN package p ON p.id = sp.package_id " +
+	"WHERE h.account = ? GROUP BY p.name_id) pc ON pc.name_id = pn.id"
+
+// sortable and filterable attributes of packages list
+var packageAttrs = attrMap{
+	"name":              {"pn.name", attrString},
+	"systems_installed": {"pc.systems_installed", attrInt},
+	"systems_updatable": {"pc.systems_updatable", attrInt},
+}
+
+type packageRow struct {
+	Name             string
+	SystemsInstalled int
+	SystemsUpdatable int
+}
+
+func (r *packageRow) item() PackageItem {
+	return PackageItem{ID: r.Name, Type: "package", Attributes: PackageItemAttributes{
+		Name:             r.Name,
+		SystemsInstalled: r.SystemsInstalled,
+		SystemsUpdatable: r.SystemsUpdatable,
+	}}
+}
+
+// package names installed on account systems
+func PackagesListHandler(c *gin.Context) {
+	params, err := ParseListParams(c, packageAttrs, "name", "pn.id", "pn.name")
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := database.Db.Table("package_name pn").
+		Select("pn.name, pc.systems_installed, pc.systems_updatable").
+		Joins(packageCountsJoin, c.GetString(middlewares.KeyAccount))
+	if format := exportFormat(c); format != "" {
+		var row packageRow
+		exportList(c, format, params, query, &row, func() interface{} { return row.item() })
+		return
+	}
+	query, total, err := params.Apply(query)
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load packages")
+		return
+	}
+	var rows []packageRow
+	err = query.Scan(&rows).Error
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load packages")
+		return
+	}
+
+	data := make([]PackageItem, len(rows))
+	for i := range rows {
+		data[i] = rows[i].item()
+	}
+	c.JSON(http.StatusOK, PackagesResponse{Data: data, Meta: params.Meta(total), Links: params.Links(total)})
+}
+
+// sortable and filterable attributes of package systems
+// evr is ordered by rank of installed version, as SQL can't compare versions by rpm rules
+var packageSystemAttrs = attrMap{
+	"id":           {"h.inventory_id", attrString},
+	"display_name": {"h.display_name", attrString},
+	"evr":          {"er.column4", attrEVR},
+	"arch":         {"p.arch", attrString},
+	"updatable":    {"(sp.latest_evra IS NOT NULL)", attrBool},
+}
+
+type packageVersion struct {
+	Epoch   int
+	Version string
+	Release string
+}
+
+func (v *packageVersion) evr() utils.EVR {
+	return utils.EVR{Epoch: v.Epoch, Version: v.Version, Release: v.Release}
+}
+
+// distinct versions of package installed on account systems, sorted by evr
+func installedVersions(tx *gorm.DB, account, name string) ([]packageVersion, error) {
+	var versions []packageVersion
+	err := tx.Table("system_package sp").
+		Select("DISTINCT p.epoch, p.version, p.release").
+		Joins("JOIN hosts h ON h.id = sp.system_id").
+		Joins("JOIN package p ON p.id = sp.package_id").
+		Joins("JOIN package_name pn ON pn.id = p.name_id").
+		Where("h.account = ? AND pn.name = ?", account, name).
+		Scan(&versions).Error
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].evr().Compare(versions[j].evr()) < 0
+	})
+	return versions, err
+}
+
+// rank of each version in sorted versions, versions equal by rpm rules have the same rank
+func versionRanks(versions []packageVersion) []int {
+	ranks := make([]int, len(versions))
+	for i := 1; i < len(versions); i++ {
+		ranks[i] = ranks[i-1]
+		if versions[i].evr().Compare(versions[i-1].evr()) != 0 {
+			ranks[i]++
+		}
+	}
+	return ranks
+}
+
+// join of installed versions matching evr filters with their ranks, values are bound as query variables
+// VALUES columns are named column1 to column4 in both PostgreSQL and SQLite,
+// row of nulls keeps the join valid and matches nothing when no version matches
+func evrRankJoin(params *ListParams, versions []packageVersion) (string, []interface{}) {
+	var rows []string
+	var args []interface{}
+	for i, rank := range versionRanks(versions) {
+		if params.MatchEVR("evr", versions[i].evr()) {
+			rows = append(rows, "(CAST(? AS INTEGER), ?, ?, CAST(? AS INTEGER))")
+			args = append(args, versions[i].Epoch, versions[i].Version, versions[i].Release, rank)
+		}
+	}
+	if len(rows) == 0 {
+		rows = append(rows, "(CAST(NULL AS INTEGER), NULL, NULL, CAST(NULL AS INTEGER))")
+	}
+	return "JOIN (VALUES " + strings.Join(rows, ", ") + ") er " +
+		"ON er.column1 = p.epoch AND er.column2 = p.version AND er.column3 = p.release", args
+}
+
+type packageSystemRow struct {
+	InventoryID string
+	DisplayName string
+	Epoch       int
+	Version     string
+	Release     string
+	Arch        string
+	LatestEVRA  *string `gorm:"column:latest_evra"`
+}
+
+func (r *packageSystemRow) item() PackageSystemItem {
+	return PackageSystemItem{ID: r.InventoryID, Type: "system", Attributes: PackageSystemItemAttributes{
+		DisplayName: r.DisplayName,
+		EVRA:        packageEVRA(r.Epoch, r.Version, r.Release, r.Arch),
+		LatestEVRA:  r.LatestEVRA,
+		Updatable:   r.LatestEVRA != nil,
+	}}
+}
+
+// account systems with installed versions of the package
+func PackageSystemsHandler(c *gin.Context) {
+	account := c.GetString(middlewares.KeyAccount)
+	versions, err := installedVersions(database.Db, account, c.Param("name"))
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load package versions")
+		return
+	}
+	params, err := ParseListParams(c, packageSystemAttrs, "id", "h.id",
+		"h.inventory_id", "h.display_name")
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(versions) == 0 {
+		abortWithError(c, http.StatusNotFound, "package not found")
+		return
+	}
+	query := database.Db.Table("system_package sp").
+		Select("h.inventory_id, h.display_name, p.epoch, p.version, p.release, p.arch, sp.latest_evra").
+		Joins("JOIN hosts h ON h.id = sp.system_id").
+		Joins("JOIN package p ON p.id = sp.package_id").
+		Joins("JOIN package_name pn ON pn.id = p.name_id").
+		Where("h.account = ? AND pn.name = ?", account, c.Param("name"))
+	rankJoin, rankArgs := evrRankJoin(params, versions)
+	query = query.Joins(rankJoin, rankArgs...)
+	if format := exportFormat(c); format != "" {
+		var row packageSystemRow
+		exportList(c, format, params, query, &row, func() interface{} { return row.item() })
+		return
+	}
+	query, total, err := params.Apply(query)
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load package systems")
+		return
+	}
+	var rows []packageSystemRow
+	err = query.Scan(&rows).Error
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load package systems")
+		return
+	}
+
+	data := make([]PackageSystemItem, len(rows))
+	for i := range rows {
+		data[i] = rows[i].item()
+	}
+	c.JSON(http.StatusOK, PackageSystemsResponse{Data: data, Meta: params.Meta(total), Links: params.Links(total)})
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"app/base/core"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// systems 1-3 of test account and 4 of other account with openssl versions, system 2 is updatable
+func createTestingPackageSystems(t *testing.T) {
+	for id := 1; id <= 3; id++ {
+		createTestingSample(id)
+	}
+	createTestingSampleAccount(4, "0000002")
+	createTestingSystemPackages(t, 1, nil, "openssl-1:1.0.2k-19.el7.x86_64", "bash-4.2.46-34.el7.x86_64")
+	createTestingSystemPackages(t, 2, map[string]string{"openssl-1:1.0.2k-8.el7.x86_64": "1:1.0.2k-19.el7.x86_64"},
+		"openssl-1:1.0.2k-8.el7.x86_64")
+	createTestingSystemPackages(t, 3, nil, "openssl-1:1.0.2k-16.el7.x86_64")
+	createTestingSystemPackages(t, 4, nil, "openssl-1:1.0.1e-60.el7.x86_64", "kernel-3.10.0-1062.el7.x86_64")
+}
+
+func TestPackagesList(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingPackageSystems(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	initRouter(PackagesListHandler).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output PackagesResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	// kernel is installed on other account system only
+	assert.Equal(t, 2, output.Meta.Total)
+	assert.Equal(t, "bash", output.Data[0].ID)
+	assert.Equal(t, "package", output.Data[0].Type)
+	assert.Equal(t, PackageItemAttributes{Name: "bash", SystemsInstalled: 1}, output.Data[0].Attributes)
+	assert.Equal(t, PackageItemAttributes{Name: "openssl", SystemsInstalled: 3, SystemsUpdatable: 1},
+		output.Data[1].Attributes)
+}
+
+func TestPackagesListFilter(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingPackageSystems(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?filter[systems_updatable]=gt:0&search=SSL", nil)
+	initRouter(PackagesListHandler).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output PackagesResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.Equal(t, 1, output.Meta.Total)
+	assert.Equal(t, "openssl", output.Data[0].ID)
+}
+
+func packageSystems(t *testing.T, query string) PackageSystemsResponse {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/openssl/systems"+query, nil)
+	initRouterWithPath(PackageSystemsHandler, "/:name/systems").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output PackageSystemsResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	return output
+}
+
+func TestPackageSystems(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingPackageSystems(t)
+
+	output := packageSystems(t, "")
+	assert.Equal(t, 3, output.Meta.Total)
+	assert.Equal(t, "INV-1", output.Data[0].ID)
+	assert.Equal(t, "system", output.Data[0].Type)
+	assert.Equal(t, "1:1.0.2k-19.el7.x86_64", output.Data[0].Attributes.EVRA)
+	assert.False(t, output.Data[0].Attributes.Updatable)
+	assert.Equal(t, "INV-2", output.Data[1].ID)
+	assert.Equal(t, "1:1.0.2k-19.el7.x86_64", *output.Data[1].Attributes.LatestEVRA)
+	assert.True(t, output.Data[1].Attributes.Updatable)
+}
+
+func TestPackageSystemsEVR(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingPackageSystems(t)
+
+	// rpm ordering, release 8 is lower than 16 and 19
+	output := packageSystems(t, "?sort=-evr")
+	assert.Equal(t, 3, len(output.Data))
+	assert.Equal(t, "INV-1", output.Data[0].ID)
+	assert.Equal(t, "INV-3", output.Data[1].ID)
+	assert.Equal(t, "INV-2", output.Data[2].ID)
+
+	output = packageSystems(t, "?filter[evr]=lt:1:1.0.2k-19.el7&sort=evr")
+	assert.Equal(t, 2, output.Meta.Total)
+	assert.Equal(t, "INV-2", output.Data[0].ID)
+	assert.Equal(t, "INV-3", output.Data[1].ID)
+
+	output = packageSystems(t, "?filter[evr]=in:1:1.0.2k-8.el7,1:1.0.2k-19.el7&filter[updatable]=false")
+	assert.Equal(t, 1, output.Meta.Total)
+	assert.Equal(t, "INV-1", output.Data[0].ID)
+
+	output = packageSystems(t, "?filter[evr]=lt:1.0.2k-19.el7")
+	assert.Equal(t, 0, output.Meta.Total)
+}
+
+// more installed versions than SQLite query variables, only versions matching evr filters are bound
+func TestPackageSystemsManyVersions(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+	nevras := make([]string, 1100)
+	for i := range nevras {
+		nevras[i] = fmt.Sprintf("openssl-1:1.0.%d-1.el7.x86_64", i)
+	}
+	createTestingSystemPackages(t, 1, nil, nevras...)
+
+	output := packageSystems(t, "?filter[evr]=geq:1:1.0.900-1.el7&sort=-evr")
+	assert.Equal(t, 200, output.Meta.Total)
+	assert.Equal(t, "1:1.0.1099-1.el7.x86_64", output.Data[0].Attributes.EVRA)
+	assert.Equal(t, "1:1.0.1098-1.el7.x86_64", output.Data[1].Attributes.EVRA)
+}
+
+func TestPackageSystemsInvalid(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingPackageSystems(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/openssl/systems?filter[evr]=lt:1.0.2k", nil)
+	initRouterWithPath(PackageSystemsHandler, "/:name/systems").ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// installed on other account system only
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/kernel/systems", nil)
+	initRouterWithPath(PackageSystemsHandler, "/:name/systems").ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":{"status":404,"title":"Not Found","detail":"package not found"}}`, w.Body.String())
+}
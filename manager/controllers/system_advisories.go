@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"app/base/database"
+	"app/base/structures"
+	"app/manager/middlewares"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"time"
+)
+
+type SystemAdvisoryItem struct {
+	// advisory name
+	ID         string                       `json:"id"`
+	Type       string                       `json:"type"`
+	Attributes SystemAdvisoryItemAttributes `json:"attributes"`
+}
+
+type SystemAdvisoryItemAttributes struct {
+	Synopsis     string    `json:"synopsis"`
+	Description  string    `json:"description"`
+	AdvisoryType string    `json:"advisory_type"`
+	Severity     *string   `json:"severity"`
+	PublicDate   time.Time `json:"public_date"`
+	// when the advisory became applicable to the system
+	FirstReported time.Time `json:"first_reported"`
+}
+
+type SystemAdvisoriesResponse struct {
+	Data  []SystemAdvisoryItem `json:"data"`
+	Meta  ListMeta             `json:"meta"`
+	Links Links                `json:"links"`
+}
+
+// sortable and filterable attributes of system advisories
+var systemAdvisoryAttrs = attrMap{
+	"id":             {"am.name", attrString},
+	"synopsis":       {"am.synopsis", attrString},
+	"advisory_type":  {"am.advisory_type", attrString},
+	"severity":       {"am.severity", attrString},
+	"public_date":    {"am.issued", attrTime},
+	"first_reported": {"sa.first_reported", attrTime},
+}
+
+type systemAdvisoryRow struct {
+	structures.AdvisoryMetadataDAO
+	FirstReported time.Time
+}
+
+func (r *systemAdvisoryRow) item() SystemAdvisoryItem {
+	return SystemAdvisoryItem{ID: r.Name, Type: "advisory", Attributes: SystemAdvisoryItemAttributes{
+		Synopsis:      r.Synopsis,
+		Description:   r.Description,
+		AdvisoryType:  r.AdvisoryType,
+		Severity:      r.Severity,
+		PublicDate:    r.Issued,
+		FirstReported: r.FirstReported,
+	}}
+}
+
+// id of account system, 0 when account has no such system
+func systemID(tx *gorm.DB, account, inventoryID string) (int, error) {
+	var ids []int
+	err := tx.Model(&structures.HostDAO{}).Where("account = ? AND inventory_id = ?", account, inventoryID).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// advisories currently applicable to system
+func SystemAdvisoriesHandler(c *gin.Context) {
+	params, err := ParseListParams(c, systemAdvisoryAttrs, "-public_date", "am.id", "am.name", "am.synopsis")
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	id, err := systemID(database.Db, c.GetString(middlewares.KeyAccount), c.Param("id"))
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load system")
+		return
+	}
+	if id == 0 {
+		abortWithError(c, http.StatusNotFound, "system not found")
+		return
+	}
+
+	query := database.Db.Table("system_advisories sa").
+		Select("am.*, sa.first_reported").
+		Joins("JOIN advisory_metadata am ON am.id = sa.advisory_id").
+		Where("sa.system_id = ? AND sa.when_patched IS NULL", id)
+	if format := exportFormat(c); format != "" {
+		var row systemAdvisoryRow
+		exportList(c, format, params, query, &row, func() interface{} { return row.item() })
+		return
+	}
+	query, total, err := params.Apply(query)
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load system advisories")
+		return
+	}
+	var rows []systemAdvisoryRow
+	err = query.Scan(&rows).Error
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load system advisories")
+		return
+	}
+
+	data := make([]SystemAdvisoryItem, len(rows))
+	for i := range rows {
+		data[i] = rows[i].item()
+	}
+	c.JSON(http.StatusOK, SystemAdvisoriesResponse{Data: data, Meta: params.Meta(total), Links: params.Links(total)})
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"app/base/core"
+	"app/base/database"
+	"app/base/structures"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSystemAdvisories(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+	sec := createTestingAdvisory(t, "RHSA-2019:0001", "security")
+	bug := createTestingAdvisory(t, "RHBA-2019:0002", "bugfix")
+	patched := createTestingAdvisory(t, "RHEA-2019:0003", "enhancement")
+	now := time.Now()
+	for _, id := range []int{sec, bug} {
+		assert.Nil(t, database.Db.Create(&structures.SystemAdvisoriesDAO{SystemID: 1, AdvisoryID: id,
+			FirstReported: now}).Error)
+	}
+	assert.Nil(t, database.Db.Create(&structures.SystemAdvisoriesDAO{SystemID: 1, AdvisoryID: patched,
+		FirstReported: now, WhenPatched: &now}).Error)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/INV-1/advisories?sort=id", nil)
+	initRouterWithPath(SystemAdvisoriesHandler, "/:id/advisories").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output SystemAdvisoriesResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.Equal(t, 2, output.Meta.Total)
+	assert.Equal(t, "RHBA-2019:0002", output.Data[0].ID)
+	assert.Equal(t, "RHSA-2019:0001", output.Data[1].ID)
+	assert.Equal(t, "advisory", output.Data[1].Type)
+	assert.Equal(t, "security", output.Data[1].Attributes.AdvisoryType)
+	assert.Equal(t, now.Unix(), output.Data[1].Attributes.FirstReported.Unix())
+}
+
+func TestSystemAdvisoriesFilterSearch(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+	for _, id := range []int{createTestingAdvisory(t, "RHSA-2019:0001", "security"),
+		createTestingAdvisory(t, "RHSA-2019:0002", "security"),
+		createTestingAdvisory(t, "RHBA-2019:0003", "bugfix")} {
+		assert.Nil(t, database.Db.Create(&structures.SystemAdvisoriesDAO{SystemID: 1, AdvisoryID: id,
+			FirstReported: time.Now()}).Error)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/INV-1/advisories?filter[advisory_type]=security&search=0002", nil)
+	initRouterWithPath(SystemAdvisoriesHandler, "/:id/advisories").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output SystemAdvisoriesResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.Equal(t, 1, output.Meta.Total)
+	assert.Equal(t, "0002", output.Meta.Search)
+	assert.Equal(t, "RHSA-2019:0002", output.Data[0].ID)
+}
+
+func TestSystemAdvisoriesOtherAccount(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSampleAccount(1, "0000002")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/INV-1/advisories", nil)
+	initRouterWithPath(SystemAdvisoriesHandler, "/:id/advisories").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":{"status":404,"title":"Not Found","detail":"system not found"}}`, w.Body.String())
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"app/base/database"
+	"app/manager/middlewares"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type SystemPackageItem struct {
+	// installed nevra
+	ID         string                      `json:"id"`
+	Type       string                      `json:"type"`
+	Attributes SystemPackageItemAttributes `json:"attributes"`
+}
+
+type SystemPackageItemAttributes struct {
+	Name string `json:"name"`
+	// installed "epoch:version-release.arch"
+	EVRA string `json:"evra"`
+	// the latest available update, null when package is up to date
+	LatestEVRA *string `json:"latest_evra"`
+	Updatable  bool    `json:"updatable"`
+}
+
+type SystemPackagesResponse struct {
+	Data  []SystemPackageItem `json:"data"`
+	Meta  ListMeta            `json:"meta"`
+	Links Links               `json:"links"`
+}
+
+// sortable and filterable attributes of system packages
+var systemPackageAttrs = attrMap{
+	"name":      {"pn.name", attrString},
+	"arch":      {"p.arch", attrString},
+	"updatable": {"(sp.latest_evra IS NOT NULL)", attrBool},
+}
+
+type systemPackageRow struct {
+	Name       string
+	Epoch      int
+	Version    string
+	Release    string
+	Arch       string
+	LatestEVRA *string `gorm:"column:latest_evra"`
+}
+
+func (r *systemPackageRow) item() SystemPackageItem {
+	return SystemPackageItem{ID: packageNevra(r.Name, r.Epoch, r.Version, r.Release, r.Arch),
+		Type: "package", Attributes: SystemPackageItemAttributes{
+			Name:       r.Name,
+			EVRA:       packageEVRA(r.Epoch, r.Version, r.Release, r.Arch),
+			LatestEVRA: r.LatestEVRA,
+			Updatable:  r.LatestEVRA != nil,
+		}}
+}
+
+// installed packages with their latest available updates
+func SystemPackagesHandler(c *gin.Context) {
+	params, err := ParseListParams(c, systemPackageAttrs, "name", "p.id", "pn.name")
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	id, err := systemID(database.Db, c.GetString(middlewares.KeyAccount), c.Param("id"))
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load system")
+		return
+	}
+	if id == 0 {
+		abortWithError(c, http.StatusNotFound, "system not found")
+		return
+	}
+
+	query := database.Db.Table("system_package sp").
+		Select("pn.name, p.epoch, p.version, p.release, p.arch, sp.latest_evra").
+		Joins("JOIN package p ON p.id = sp.package_id").
+		Joins("JOIN package_name pn ON pn.id = p.name_id").
+		Where("sp.system_id = ?", id)
+	if format := exportFormat(c); format != "" {
+		var row systemPackageRow
+		exportList(c, format, params, query, &row, func() interface{} { return row.item() })
+		return
+	}
+	query, total, err := params.Apply(query)
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load system packages")
+		return
+	}
+	var rows []systemPackageRow
+	err = query.Scan(&rows).Error
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load system packages")
+		return
+	}
+
+	data := make([]SystemPackageItem, len(rows))
+	for i := range rows {
+		data[i] = rows[i].item()
+	}
+	c.JSON(http.StatusOK, SystemPackagesResponse{Data: data, Meta: params.Meta(total), Links: params.Links(total)})
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"app/base/core"
+	"app/base/database"
+	"app/base/structures"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func createTestingSystemPackages(t *testing.T, systemID int, latest map[string]string, nevras ...string) {
+	ids, err := database.GetOrCreatePackages(database.Db, nevras)
+	assert.Nil(t, err)
+	for i, id := range ids {
+		item := structures.SystemPackageDAO{SystemID: systemID, PackageID: id}
+		if evra, has := latest[nevras[i]]; has {
+			item.LatestEVRA = &evra
+		}
+		assert.Nil(t, database.Db.Create(&item).Error)
+	}
+}
+
+func TestSystemPackages(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+	createTestingSystemPackages(t, 1, map[string]string{"bash-4.2.46-34.el7.x86_64": "0:4.2.46-35.el7.x86_64"},
+		"bash-4.2.46-34.el7.x86_64", "kernel-1:3.10.0-1062.el7.x86_64")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/INV-1/packages", nil)
+	initRouterWithPath(SystemPackagesHandler, "/:id/packages").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output SystemPackagesResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.Equal(t, 2, len(output.Data))
+	assert.Equal(t, "bash-4.2.46-34.el7.x86_64", output.Data[0].ID)
+	assert.Equal(t, "package", output.Data[0].Type)
+	assert.Equal(t, "0:4.2.46-34.el7.x86_64", output.Data[0].Attributes.EVRA)
+	assert.Equal(t, "0:4.2.46-35.el7.x86_64", *output.Data[0].Attributes.LatestEVRA)
+	assert.True(t, output.Data[0].Attributes.Updatable)
+	assert.Equal(t, "kernel-1:3.10.0-1062.el7.x86_64", output.Data[1].ID)
+	assert.Equal(t, "kernel", output.Data[1].Attributes.Name)
+	assert.Nil(t, output.Data[1].Attributes.LatestEVRA)
+	assert.False(t, output.Data[1].Attributes.Updatable)
+}
+
+func TestSystemPackagesFilterSearch(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+	createTestingSystemPackages(t, 1, map[string]string{"bash-4.2.46-34.el7.x86_64": "0:4.2.46-35.el7.x86_64"},
+		"bash-4.2.46-34.el7.x86_64", "bash-completion-1:2.1-6.el7.noarch", "kernel-3.10.0-1062.el7.x86_64")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/INV-1/packages?search=BASH&filter[updatable]=false", nil)
+	initRouterWithPath(SystemPackagesHandler, "/:id/packages").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output SystemPackagesResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.Equal(t, 1, output.Meta.Total)
+	assert.Equal(t, "bash-completion", output.Data[0].Attributes.Name)
+}
+
+func TestSystemPackagesNotFound(t *testing.T) {
+	core.SetupTestEnvironment()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/INV-1/packages", nil)
+	initRouterWithPath(SystemPackagesHandler, "/:id/packages").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"app/base/database"
+	"app/base/structures"
+	"app/manager/middlewares"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"time"
+)
+
+type SystemItem struct {
+	// inventory id
+	ID         string               `json:"id"`
+	Type       string               `json:"type"`
+	Attributes SystemItemAttributes `json:"attributes"`
+}
+
+type SystemItemAttributes struct {
+	DisplayName    string     `json:"display_name"`
+	LastEvaluation *time.Time `json:"last_evaluation"`
+	LastUpload     *time.Time `json:"last_upload"`
+	// stale timestamps are set by inventory, system is stale after stale_timestamp
+	Stale                 bool       `json:"stale"`
+	StaleTimestamp        *time.Time `json:"stale_timestamp"`
+	StaleWarningTimestamp *time.Time `json:"stale_warning_timestamp"`
+	RhsaCount             int        `json:"rhsa_count"`
+	RhbaCount             int        `json:"rhba_count"`
+	RheaCount             int        `json:"rhea_count"`
+	OptOut                bool       `json:"opt_out"`
+}
+
+type SystemsResponse struct {
+	Data  []SystemItem `json:"data"`
+	Meta  ListMeta     `json:"meta"`
+	Links Links        `json:"links"`
+}
+
+type SystemDetailResponse struct {
+	Data SystemItem `json:"data"`
+}
+
+// PATCH body, only listed attributes are changed
+type SystemUpdateRequest struct {
+	OptOut *bool `json:"opt_out"`
+}
+
+// hosts columns shown by systems endpoints
+type systemRow struct {
+	InventoryID           string
+	DisplayName           string
+	LastEvaluation        *time.Time
+	LastUpload            *time.Time
+	Stale                 bool
+	StaleTimestamp        *time.Time
+	StaleWarningTimestamp *time.Time
+	AdvisorySecCountCache int
+	AdvisoryBugCountCache int
+	AdvisoryEnhCountCache int
+	OptOut                bool
+}
+
+// boolean in PostgreSQL, 0 or 1 in SQLite, which compares timestamps stored in UTC as text
+const staleExpr = "(stale_timestamp IS NOT NULL AND stale_timestamp < CURRENT_TIMESTAMP)"
+
+// sortable and filterable attributes of systems list
+var systemAttrs = attrMap{
+	"id":                      {"inventory_id", attrString},
+	"display_name":            {"display_name", attrString},
+	"last_evaluation":         {"last_evaluation", attrTime},
+	"last_upload":             {"last_upload", attrTime},
+	"stale":                   {staleExpr, attrBool},
+	"stale_timestamp":         {"stale_timestamp", attrTime},
+	"stale_warning_timestamp": {"stale_warning_timestamp", attrTime},
+	"rhsa_count":              {"advisory_sec_count_cache", attrInt},
+	"rhba_count":              {"advisory_bug_count_cache", attrInt},
+	"rhea_count":              {"advisory_enh_count_cache", attrInt},
+	"opt_out":                 {"opt_out", attrBool},
+}
+
+// counts are kept by evaluator, so listing doesn't need to join advisories
+const systemColumns = "inventory_id, display_name, last_evaluation, last_upload, " + staleExpr + " AS stale, " +
+	"stale_timestamp, stale_warning_timestamp, " +
+	"advisory_sec_count_cache, advisory_bug_count_cache, advisory_enh_count_cache, opt_out"
+
+func (r *systemRow) item() SystemItem {
+	return SystemItem{ID: r.InventoryID, Type: "system", Attributes: SystemItemAttributes{
+		DisplayName:           r.DisplayName,
+		LastEvaluation:        r.LastEvaluation,
+		LastUpload:            r.LastUpload,
+		Stale:                 r.Stale,
+		StaleTimestamp:        r.StaleTimestamp,
+		StaleWarningTimestamp: r.StaleWarningTimestamp,
+		RhsaCount:             r.AdvisorySecCountCache,
+		RhbaCount:             r.AdvisoryBugCountCache,
+		RheaCount:             r.AdvisoryEnhCountCache,
+		OptOut:                r.OptOut,
+	}}
+}
+
+// systems of given account
+func systemsQuery(tx *gorm.DB, account string) *gorm.DB {
+	return tx.Model(&structures.HostDAO{}).Select(systemColumns).Where("account = ?", account)
+}
+
+// system by inventory id, nil when account has no such system
+func loadSystem(tx *gorm.DB, account, inventoryID string) (*systemRow, error) {
+	var rows []systemRow
+	err := systemsQuery(tx, account).Where("inventory_id = ?", inventoryID).Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+func SystemsListHandler(c *gin.Context) {
+	params, err := ParseListParams(c, systemAttrs, "id", "id", "inventory_id", "display_name")
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := systemsQuery(database.Db, c.GetString(middlewares.KeyAccount))
+	if format := exportFormat(c); format != "" {
+		var row systemRow
+		exportList(c, format, params, query, &row, func() interface{} { return row.item() })
+		return
+	}
+	query, total, err := params.Apply(query)
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load systems")
+		return
+	}
+	var rows []systemRow
+	err = query.Scan(&rows).Error
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load systems")
+		return
+	}
+
+	data := make([]SystemItem, len(rows))
+	for i := range rows {
+		data[i] = rows[i].item()
+	}
+	c.JSON(http.StatusOK, SystemsResponse{Data: data, Meta: params.Meta(total), Links: params.Links(total)})
+}
+
+func SystemDetailHandler(c *gin.Context) {
+	system, err := loadSystem(database.Db, c.GetString(middlewares.KeyAccount), c.Param("id"))
+	if err != nil {
+		abortWithInternalError(c, err, "unable to load system")
+		return
+	}
+	if system == nil {
+		abortWithError(c, http.StatusNotFound, "system not found")
+		return
+	}
+	c.JSON(http.StatusOK, SystemDetailResponse{Data: system.item()})
+}
+
+func SystemDeleteHandler(c *gin.Context) {
+	var system *systemRow
+	err := database.Transaction(func(tx *gorm.DB) error {
+		var err error
+		system, err = loadSystem(tx, c.GetString(middlewares.KeyAccount), c.Param("id"))
+		if err != nil || system == nil {
+			return err
+		}
+		_, err = database.DeleteSystem(tx, system.InventoryID)
+		return err
+	})
+	if err != nil {
+		abortWithInternalError(c, err, "unable to delete system")
+		return
+	}
+	if system == nil {
+		abortWithError(c, http.StatusNotFound, "system not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func SystemUpdateHandler(c *gin.Context) {
+	var request SystemUpdateRequest
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	// "required" binding rejects false
+	if request.OptOut == nil {
+		abortWithError(c, http.StatusBadRequest, "missing 'opt_out' attribute")
+		return
+	}
+
+	account := c.GetString(middlewares.KeyAccount)
+	var system *systemRow
+	err = database.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&structures.HostDAO{}).Where("inventory_id = ? AND account = ?", c.Param("id"), account).
+			Update("opt_out", *request.OptOut).Error
+		if err != nil {
+			return err
+		}
+		system, err = loadSystem(tx, account, c.Param("id"))
+		return err
+	})
+	if err != nil {
+		abortWithInternalError(c, err, "unable to update system")
+		return
+	}
+	if system == nil {
+		abortWithError(c, http.StatusNotFound, "system not found")
+		return
+	}
+	c.JSON(http.StatusOK, SystemDetailResponse{Data: system.item()})
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"app/base/core"
+	"app/base/database"
+	"app/base/structures"
+	"app/base/utils"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSystemsList(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+	createTestingSample(2)
+	assert.Nil(t, database.Db.Model(&structures.HostDAO{ID: 2}).
+		Updates(map[string]interface{}{"display_name": "second", "advisory_sec_count_cache": 3}).Error)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	initRouter(SystemsListHandler).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output SystemsResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.Equal(t, 2, len(output.Data))
+	assert.Equal(t, "INV-1", output.Data[0].ID)
+	assert.Equal(t, "system", output.Data[0].Type)
+	assert.Equal(t, "INV-2", output.Data[1].ID)
+	assert.Equal(t, "second", output.Data[1].Attributes.DisplayName)
+	assert.Equal(t, 3, output.Data[1].Attributes.RhsaCount)
+	assert.Nil(t, output.Data[1].Attributes.LastUpload)
+}
+
+func TestSystemsListStale(t *testing.T) {
+	core.SetupTestEnvironment()
+	now := time.Now().UTC()
+	for i, stale := range []time.Time{now.Add(time.Hour), now.Add(-time.Hour)} {
+		createTestingSample(i + 1)
+		assert.Nil(t, database.Db.Model(&structures.HostDAO{ID: i + 1}).
+			Updates(map[string]interface{}{"stale_timestamp": stale, "last_upload": now}).Error)
+	}
+	createTestingSample(3)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	initRouter(SystemsListHandler).ServeHTTP(w, req)
+	var output SystemsResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.Equal(t, 3, len(output.Data))
+	assert.False(t, output.Data[0].Attributes.Stale)
+	assert.True(t, output.Data[1].Attributes.Stale)
+	assert.False(t, output.Data[2].Attributes.Stale)
+	assert.True(t, now.Equal(*output.Data[0].Attributes.LastUpload))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?filter[stale]=true", nil)
+	initRouter(SystemsListHandler).ServeHTTP(w, req)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.Equal(t, 1, len(output.Data))
+	assert.Equal(t, "INV-2", output.Data[0].ID)
+}
+
+func TestSystemsListSortFilter(t *testing.T) {
+	core.SetupTestEnvironment()
+	for i := 1; i <= 5; i++ {
+		createTestingSample(i)
+		assert.Nil(t, database.Db.Model(&structures.HostDAO{ID: i}).Update("advisory_sec_count_cache", i%3).Error)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?sort=-rhsa_count&filter[rhsa_count]=gt:0&limit=2&offset=2", nil)
+	initRouter(SystemsListHandler).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output SystemsResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	// INV-2, INV-5 with count 2 on the first page, INV-1, INV-4 with count 1 on the second one
+	assert.Equal(t, 2, len(output.Data))
+	assert.Equal(t, "INV-1", output.Data[0].ID)
+	assert.Equal(t, "INV-4", output.Data[1].ID)
+	assert.Equal(t, 4, output.Meta.Total)
+	assert.Equal(t, map[string]string{"rhsa_count": "gt:0"}, output.Meta.Filter)
+	assert.NotNil(t, output.Links.Prev)
+	assert.Nil(t, output.Links.Next)
+}
+
+func TestSystemsListInvalidParams(t *testing.T) {
+	core.SetupTestEnvironment()
+
+	for _, query := range []string{"sort=request", "filter[request]=r", "filter[rhsa_count]=gt:x", "limit=0"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/?"+query, nil)
+		initRouter(SystemsListHandler).ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestSystemsListEmpty(t *testing.T) {
+	core.SetupTestEnvironment()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	initRouter(SystemsListHandler).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"data":[],"meta":{"total":0,"limit":20,"offset":0,"sort":["id"],"filter":{}},`+
+		`"links":{"first":"/?limit=20\u0026offset=0","prev":null,"next":null,"last":"/?limit=20\u0026offset=0"}}`,
+		w.Body.String())
+}
+
+func TestSystemDetail(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/INV-1", nil)
+	initRouterWithPath(SystemDetailHandler, "/:id").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output SystemDetailResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.Equal(t, "INV-1", output.Data.ID)
+	assert.Nil(t, output.Data.Attributes.LastEvaluation)
+	assert.False(t, output.Data.Attributes.OptOut)
+}
+
+func TestSystemDetailNotFound(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/INV-100", nil)
+	initRouterWithPath(SystemDetailHandler, "/:id").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":{"status":404,"title":"Not Found","detail":"system not found"}}`, w.Body.String())
+}
+
+func TestSystemDelete(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+	createTestingSample(2)
+	ids, err := database.GetOrCreatePackages(database.Db, []string{"bash-4.2.46-34.el7.x86_64"})
+	assert.Nil(t, err)
+	assert.Nil(t, database.Db.Create(&structures.SystemPackageDAO{SystemID: 1, PackageID: ids[0]}).Error)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/INV-1", nil)
+	initRouterWithMethod(SystemDeleteHandler, "DELETE", "/:id").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	var hosts []structures.HostDAO
+	assert.Nil(t, database.Db.Find(&hosts).Error)
+	assert.Equal(t, 1, len(hosts))
+	assert.Equal(t, "INV-2", hosts[0].InventoryID)
+	cnt := 0
+	assert.Nil(t, database.Db.Model(&structures.SystemPackageDAO{}).Count(&cnt).Error)
+	assert.Equal(t, 0, cnt)
+}
+
+func TestSystemDeleteNotFound(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/INV-2", nil)
+	initRouterWithMethod(SystemDeleteHandler, "DELETE", "/:id").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	cnt, err := database.HostsCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, cnt)
+}
+
+func TestSystemUpdate(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/INV-1", strings.NewReader(`{"opt_out": true}`))
+	initRouterWithMethod(SystemUpdateHandler, "PATCH", "/:id").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var output SystemDetailResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.True(t, output.Data.Attributes.OptOut)
+	var host structures.HostDAO
+	assert.Nil(t, database.Db.Where("inventory_id = ?", "INV-1").First(&host).Error)
+	assert.True(t, host.OptOut)
+}
+
+func TestSystemUpdateInvalid(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+
+	for _, body := range []string{`{}`, `{"opt_out": "yes"}`, `not json`} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/INV-1", strings.NewReader(body))
+		initRouterWithMethod(SystemUpdateHandler, "PATCH", "/:id").ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		var output utils.ErrorResponse
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+		assert.Equal(t, http.StatusBadRequest, output.Error.Status)
+	}
+}
+
+func TestSystemUpdateNotFound(t *testing.T) {
+	core.SetupTestEnvironment()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/INV-1", strings.NewReader(`{"opt_out": false}`))
+	initRouterWithMethod(SystemUpdateHandler, "PATCH", "/:id").ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSystemsOtherAccount(t *testing.T) {
+	core.SetupTestEnvironment()
+	createTestingSample(1)
+	createTestingSampleAccount(2, "0000002")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	initRouter(SystemsListHandler).ServeHTTP(w, req)
+	var output SystemsResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &output))
+	assert.Equal(t, 1, len(output.Data))
+	assert.Equal(t, "INV-1", output.Data[0].ID)
+
+	for _, method := range []string{"GET", "DELETE", "PATCH"} {
+		handler := map[string]gin.HandlerFunc{"GET": SystemDetailHandler, "DELETE": SystemDeleteHandler,
+			"PATCH": SystemUpdateHandler}[method]
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/INV-2", strings.NewReader(`{"opt_out": true}`))
+		initRouterWithMethod(handler, method, "/:id").ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code, method)
+	}
+	var host structures.HostDAO
+	assert.Nil(t, database.Db.Where("inventory_id = ?", "INV-2").First(&host).Error)
+	assert.False(t, host.OptOut)
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"app/base/database"
 	"app/manager/middlewares"
+	"fmt"
 	"github.com/gin-gonic/gin"
 
 	"app/base/structures"
@@ -13,14 +14,32 @@ func initRouter(handler gin.HandlerFunc) *gin.Engine {
 }
 
 func initRouterWithPath(handler gin.HandlerFunc, path string) *gin.Engine {
+	return initRouterWithMethod(handler, "GET", path)
+}
+
+func initRouterWithMethod(handler gin.HandlerFunc, method, path string) *gin.Engine {
+	return initRouterWithAccount(handler, method, path, testAccount)
+}
+
+// requests are authenticated as given account
+func initRouterWithAccount(handler gin.HandlerFunc, method, path, account string) *gin.Engine {
 	router := gin.Default()
 	router.Use(middlewares.RequestResponseLogger())
-	router.GET(path, handler)
+	router.Use(func(c *gin.Context) {
+		c.Set(middlewares.KeyAccount, account)
+	})
+	router.Handle(method, path, handler)
 	return router
 }
 
+const testAccount = "0000001"
+
 func createTestingSample(id int) {
-	record := &structures.HostDAO{ID: id, Request: "r",
+	createTestingSampleAccount(id, testAccount)
+}
+
+func createTestingSampleAccount(id int, account string) {
+	record := &structures.HostDAO{ID: id, InventoryID: fmt.Sprintf("INV-%d", id), Account: account, Request: "r",
 		Checksum: "454349e422f05297191ead13e21d3db520e5abef52055e4964b82fb213f593a1"}
 	err := database.Db.Create(record).Error
 	if err != nil {
@@ -2,11 +2,13 @@ package manager
 
 import (
 	"app/base/utils"
+	"app/manager/controllers"
 	"app/manager/middlewares"
 	"app/manager/routes"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
 	"github.com/zsais/go-gin-prometheus"
+	"net/http"
 )
 
 func RunManager() {
@@ -18,15 +20,19 @@ func RunManager() {
 	prometheus := ginprometheus.NewPrometheus("gin")
 	prometheus.Use(app)
 	app.Use(middlewares.RequestResponseLogger())
-	app.Use(gzip.Gzip(gzip.DefaultCompression))
-	app.HandleMethodNotAllowed = true
+	app.Use(middlewares.Gzip(gzip.DefaultCompression, controllers.IsExportRequest))
+
+	middlewares.ConfigureRBAC()
 
 	// routes
 	routes.Init(app)
 
-	err := app.Run(":8080")
-	if err != nil {
-		utils.Log("err", err.Error()).Error()
-		panic(err)
-	}
+	ctx, cancel := utils.SignalContext()
+	defer cancel()
+
+	// on SIGTERM stop accepting connections and finish in-flight requests
+	server := &http.Server{Addr: ":8080", Handler: app}
+	err := utils.RunServer(ctx, server, utils.GetShutdownTimeout())
+	utils.LogServerError("manager", err)
+	utils.Log().Info("Manager stopped")
 }
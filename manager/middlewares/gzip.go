@@ -0,0 +1,17 @@
+package middlewares
+
+import (
+	"github.com/gin-contrib/gzip"
+	"github.com/gin-gonic/gin"
+)
+
+// compress responses except streamed ones, gzip writer holds output until the handler returns
+func Gzip(level int, streamed func(c *gin.Context) bool) gin.HandlerFunc {
+	compress := gzip.Gzip(level)
+	return func(c *gin.Context) {
+		if streamed(c) {
+			return
+		}
+		compress(c)
+	}
+}
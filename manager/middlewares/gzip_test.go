@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"compress/gzip"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func gzipRequest(accept string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Use(Gzip(gzip.DefaultCompression, func(c *gin.Context) bool {
+		return c.GetHeader("Accept") == "text/csv"
+	}))
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "id\n")
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Accept", accept)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGzip(t *testing.T) {
+	w := gzipRequest("application/json")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+
+	w = gzipRequest("text/csv")
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "id\n", w.Body.String())
+}
@@ -0,0 +1,84 @@
+package middlewares
+
+import (
+	"app/base/utils"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const (
+	identityHeader = "x-rh-identity"
+	// gin context keys set by Authenticator
+	KeyIdentity = "identity"
+	KeyAccount  = "account"
+)
+
+// identity types allowed to access the api
+var allowedIdentityTypes = map[string]bool{
+	"User":   true,
+	"System": true,
+}
+
+// decoded x-rh-identity header, set by 3scale gateway
+type XRHIdentity struct {
+	Identity Identity `json:"identity"`
+}
+
+type Identity struct {
+	AccountNumber string                 `json:"account_number"`
+	Type          string                 `json:"type"`
+	User          *User                  `json:"user,omitempty"`
+	Internal      map[string]interface{} `json:"internal,omitempty"`
+}
+
+type User struct {
+	Username   string `json:"username"`
+	Email      string `json:"email"`
+	IsOrgAdmin bool   `json:"is_org_admin"`
+}
+
+// parse base64 encoded x-rh-identity header
+func ParseIdentity(header string) (*Identity, error) {
+	decoded, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return nil, err
+	}
+	var xrhid XRHIdentity
+	err = json.Unmarshal(decoded, &xrhid)
+	if err != nil {
+		return nil, err
+	}
+	return &xrhid.Identity, nil
+}
+
+// reject requests without valid identity, put identity and its account to context
+// missing or malformed identity is 401, identity which can't access the api is 403
+func Authenticator() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader(identityHeader)
+		if header == "" {
+			utils.AbortWithError(c, http.StatusUnauthorized, "missing x-rh-identity header")
+			return
+		}
+		identity, err := ParseIdentity(header)
+		if err != nil {
+			utils.Log("err", err.Error()).Warn("unable to parse identity")
+			utils.AbortWithError(c, http.StatusUnauthorized, "invalid x-rh-identity header")
+			return
+		}
+		if !allowedIdentityTypes[identity.Type] {
+			utils.AbortWithError(c, http.StatusForbidden, "identity type '"+identity.Type+"' is not allowed")
+			return
+		}
+		if identity.AccountNumber == "" {
+			utils.AbortWithError(c, http.StatusForbidden, "identity without account number")
+			return
+		}
+
+		c.Set(KeyIdentity, identity)
+		c.Set(KeyAccount, identity.AccountNumber)
+		c.Next()
+	}
+}
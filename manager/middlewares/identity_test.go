@@ -0,0 +1,57 @@
+package middlewares
+
+import (
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func encodeIdentity(identity string) string {
+	return base64.StdEncoding.EncodeToString([]byte(identity))
+}
+
+func authenticate(header string) (*httptest.ResponseRecorder, *Identity) {
+	var identity *Identity
+	router := gin.New()
+	router.GET("/", Authenticator(), func(c *gin.Context) {
+		identity = c.MustGet(KeyIdentity).(*Identity)
+		c.String(http.StatusOK, c.GetString(KeyAccount))
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	if header != "" {
+		req.Header.Set("x-rh-identity", header)
+	}
+	router.ServeHTTP(w, req)
+	return w, identity
+}
+
+func TestAuthenticator(t *testing.T) {
+	w, identity := authenticate(encodeIdentity(`{"identity": {"account_number": "0000001", "type": "User",
+		"user": {"username": "jdoe", "is_org_admin": true}}}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0000001", w.Body.String())
+	assert.Equal(t, "jdoe", identity.User.Username)
+	assert.True(t, identity.User.IsOrgAdmin)
+}
+
+func TestAuthenticatorUnauthorized(t *testing.T) {
+	for _, header := range []string{"", "not base64!", encodeIdentity("not json")} {
+		w, _ := authenticate(header)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, header)
+	}
+}
+
+func TestAuthenticatorForbidden(t *testing.T) {
+	for _, identity := range []string{
+		`{"identity": {"account_number": "0000001", "type": "Associate"}}`,
+		`{"identity": {"type": "User"}}`,
+	} {
+		w, _ := authenticate(encodeIdentity(identity))
+		assert.Equal(t, http.StatusForbidden, w.Code, identity)
+		assert.Contains(t, w.Body.String(), `"status":403`)
+	}
+}
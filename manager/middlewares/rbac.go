@@ -0,0 +1,192 @@
+package middlewares
+
+import (
+	"app/base/rbac"
+	"app/base/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resolves permissions of authenticated caller, e.g. "patch:*:read"
+type PermissionSource interface {
+	Permissions(ctx context.Context, header string, identity *Identity) ([]string, error)
+}
+
+// RBAC service, identity header is forwarded to it
+type remoteSource struct {
+	client *rbac.Client
+}
+
+func (s *remoteSource) Permissions(ctx context.Context, header string, _ *Identity) ([]string, error) {
+	return s.client.Permissions(ctx, header)
+}
+
+// permissions by account number, "*" applies to accounts which are not listed
+type fileSource struct {
+	permissions map[string][]string
+}
+
+func (s *fileSource) Permissions(_ context.Context, _ string, identity *Identity) ([]string, error) {
+	if permissions, ok := s.permissions[identity.AccountNumber]; ok {
+		return permissions, nil
+	}
+	return s.permissions["*"], nil
+}
+
+func loadFileSource(path string) (*fileSource, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var source fileSource
+	err = json.Unmarshal(data, &source.permissions)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", path, err.Error())
+	}
+	return &source, nil
+}
+
+// maximum number of cached identities, expired ones are dropped when it's reached
+const maxCacheSize = 10000
+
+type cachedPermissions struct {
+	permissions []string
+	expires     time.Time
+}
+
+// permissions by identity header, kept for ttl
+type permissionCache struct {
+	source PermissionSource
+	ttl    time.Duration
+	lock   sync.Mutex
+	items  map[string]cachedPermissions
+}
+
+func newPermissionCache(source PermissionSource, ttl time.Duration) *permissionCache {
+	return &permissionCache{source: source, ttl: ttl, items: map[string]cachedPermissions{}}
+}
+
+func (c *permissionCache) Permissions(ctx context.Context, header string, identity *Identity) ([]string, error) {
+	now := time.Now()
+	c.lock.Lock()
+	item, ok := c.items[header]
+	c.lock.Unlock()
+	if ok && now.Before(item.expires) {
+		return item.permissions, nil
+	}
+
+	// not locked while waiting for source, concurrent misses may load permissions twice
+	permissions, err := c.source.Permissions(ctx, header, identity)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.items) >= maxCacheSize {
+		for key, item := range c.items {
+			if !now.Before(item.expires) {
+				delete(c.items, key)
+			}
+		}
+	}
+	if len(c.items) < maxCacheSize {
+		c.items[header] = cachedPermissions{permissions: permissions, expires: now.Add(c.ttl)}
+	}
+	return permissions, nil
+}
+
+var permissionSource PermissionSource
+
+// choose permission source, "rbac" uses RBAC service, "file" static permissions from json file
+func ConfigureRBAC() {
+	name := utils.Getenv("RBAC_SOURCE", "rbac")
+	var source PermissionSource
+	switch name {
+	case "rbac":
+		timeout, err := strconv.Atoi(utils.Getenv("RBAC_TIMEOUT", "10"))
+		if err != nil {
+			panic(err)
+		}
+		source = &remoteSource{client: rbac.NewClient(utils.GetenvOrFail("RBAC_ADDRESS"),
+			time.Duration(timeout)*time.Second)}
+	case "file":
+		file, err := loadFileSource(utils.GetenvOrFail("RBAC_FILE"))
+		if err != nil {
+			panic(err)
+		}
+		source = file
+	default:
+		panic(fmt.Sprintf("Unknown RBAC source '%s'", name))
+	}
+
+	ttl, err := strconv.Atoi(utils.Getenv("RBAC_CACHE_TTL", "60"))
+	if err != nil {
+		panic(err)
+	}
+	permissionSource = newPermissionCache(source, time.Duration(ttl)*time.Second)
+	utils.Log("source", name, "ttl", ttl).Info("RBAC configured")
+}
+
+// granted permission matches required one when it has the same or wildcard application, resource and verb
+// wildcards are expanded on granted side only, as by RBAC service, required permission names single resource
+func HasPermission(granted []string, required string) bool {
+	requiredParts := strings.Split(required, ":")
+	for _, permission := range granted {
+		parts := strings.Split(permission, ":")
+		if len(parts) != len(requiredParts) {
+			continue
+		}
+		matches := true
+		for i := range parts {
+			if parts[i] != "*" && parts[i] != requiredParts[i] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// permission required for request to resource, read-only methods need read permission, the others write one
+func requiredPermission(resource, method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return "patch:" + resource + ":read"
+	default:
+		return "patch:" + resource + ":write"
+	}
+}
+
+// reject requests without required permission for given resource, has to follow Authenticator
+func RBAC(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := c.MustGet(KeyIdentity).(*Identity)
+		if permissionSource == nil {
+			utils.AbortWithError(c, http.StatusInternalServerError, "RBAC is not configured")
+			return
+		}
+		granted, err := permissionSource.Permissions(c.Request.Context(), c.GetHeader(identityHeader), identity)
+		if err != nil {
+			utils.Log("err", err.Error()).Error("unable to resolve permissions")
+			utils.AbortWithError(c, http.StatusServiceUnavailable, "unable to resolve permissions")
+			return
+		}
+		required := requiredPermission(resource, c.Request.Method)
+		if !HasPermission(granted, required) {
+			utils.AbortWithError(c, http.StatusForbidden, "missing permission "+required)
+			return
+		}
+		c.Next()
+	}
+}
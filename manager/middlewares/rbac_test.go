@@ -0,0 +1,122 @@
+package middlewares
+
+import (
+	"app/base/rbac"
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func authorize(method, account string) *httptest.ResponseRecorder {
+	return authorizeResource("systems", method, account)
+}
+
+func authorizeResource(resource, method, account string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Handle(method, "/", Authenticator(), RBAC(resource), func(c *gin.Context) {
+		c.String(http.StatusOK, "OK")
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, "/", nil)
+	req.Header.Set("x-rh-identity", encodeIdentity(`{"identity": {"account_number": "`+account+`", "type": "User"}}`))
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestHasPermission(t *testing.T) {
+	assert.True(t, HasPermission([]string{"patch:*:read"}, "patch:systems:read"))
+	assert.True(t, HasPermission([]string{"inventory:*:*", "patch:*:*"}, "patch:systems:write"))
+	assert.True(t, HasPermission([]string{"*:*:*"}, "patch:advisories:read"))
+	assert.False(t, HasPermission([]string{"patch:*:read"}, "patch:systems:write"))
+	// access to single resource grants access to that resource only
+	assert.True(t, HasPermission([]string{"patch:systems:read"}, "patch:systems:read"))
+	assert.False(t, HasPermission([]string{"patch:systems:read"}, "patch:advisories:read"))
+	assert.False(t, HasPermission([]string{"inventory:*:read", "patch:read"}, "patch:systems:read"))
+	assert.False(t, HasPermission(nil, "patch:systems:read"))
+}
+
+func TestRBACRemote(t *testing.T) {
+	server := rbac.NewFakeServer(map[string][]string{"0000001": {"patch:*:read"}, "0000002": {"patch:*:*"}})
+	defer server.Close()
+	permissionSource = newPermissionCache(&remoteSource{client: rbac.NewClient(server.URL, time.Second)}, time.Minute)
+	defer func() { permissionSource = nil }()
+
+	assert.Equal(t, http.StatusOK, authorize("GET", "0000001").Code)
+	assert.Equal(t, http.StatusForbidden, authorize("DELETE", "0000001").Code)
+	assert.Equal(t, http.StatusOK, authorize("PATCH", "0000002").Code)
+	assert.Equal(t, http.StatusForbidden, authorize("GET", "0000003").Code)
+	// permissions of each identity are loaded once
+	assert.Equal(t, 3, server.Requests())
+}
+
+func TestRBACResource(t *testing.T) {
+	server := rbac.NewFakeServer(map[string][]string{"0000001": {"patch:systems:read", "patch:advisories:*"}})
+	defer server.Close()
+	permissionSource = newPermissionCache(&remoteSource{client: rbac.NewClient(server.URL, time.Second)}, time.Minute)
+	defer func() { permissionSource = nil }()
+
+	assert.Equal(t, http.StatusOK, authorizeResource("systems", "GET", "0000001").Code)
+	w := authorizeResource("systems", "DELETE", "0000001")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "missing permission patch:systems:write")
+	assert.Equal(t, http.StatusOK, authorizeResource("advisories", "PATCH", "0000001").Code)
+	assert.Equal(t, http.StatusForbidden, authorizeResource("packages", "GET", "0000001").Code)
+}
+
+func TestRBACRemoteUnavailable(t *testing.T) {
+	server := rbac.NewFakeServer(map[string][]string{"0000001": {"patch:*:read"}})
+	defer server.Close()
+	permissionSource = newPermissionCache(&remoteSource{client: rbac.NewClient(server.URL, time.Second)}, time.Minute)
+	defer func() { permissionSource = nil }()
+
+	server.FailNext(1)
+	assert.Equal(t, http.StatusServiceUnavailable, authorize("GET", "0000001").Code)
+	// failures are not cached
+	assert.Equal(t, http.StatusOK, authorize("GET", "0000001").Code)
+}
+
+func TestRBACNotConfigured(t *testing.T) {
+	assert.Equal(t, http.StatusInternalServerError, authorize("GET", "0000001").Code)
+}
+
+func TestPermissionCacheExpires(t *testing.T) {
+	server := rbac.NewFakeServer(map[string][]string{"0000001": {"patch:*:read"}})
+	defer server.Close()
+	cache := newPermissionCache(&remoteSource{client: rbac.NewClient(server.URL, time.Second)}, time.Millisecond)
+	identity := &Identity{AccountNumber: "0000001"}
+	header := encodeIdentity(`{"identity": {"account_number": "0000001"}}`)
+
+	for i := 0; i < 2; i++ {
+		permissions, err := cache.Permissions(context.Background(), header, identity)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"patch:*:read"}, permissions)
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.Equal(t, 2, server.Requests())
+}
+
+func TestConfigureRBACFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "rbac-*.json")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(`{"0000001": ["patch:*:*"], "*": ["patch:*:read"]}`)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	assert.Nil(t, os.Setenv("RBAC_SOURCE", "file"))
+	assert.Nil(t, os.Setenv("RBAC_FILE", file.Name()))
+	defer os.Unsetenv("RBAC_SOURCE")
+	defer os.Unsetenv("RBAC_FILE")
+	ConfigureRBAC()
+	defer func() { permissionSource = nil }()
+
+	assert.Equal(t, http.StatusOK, authorize("DELETE", "0000001").Code)
+	assert.Equal(t, http.StatusOK, authorize("GET", "0000002").Code)
+	assert.Equal(t, http.StatusForbidden, authorize("DELETE", "0000002").Code)
+}
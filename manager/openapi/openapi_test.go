@@ -0,0 +1,74 @@
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type testBase struct {
+	ID string `json:"id"`
+}
+
+type testItem struct {
+	testBase
+	Name     string            `json:"name"`
+	Count    int               `json:"count"`
+	Checked  *time.Time        `json:"checked"`
+	Tags     []string          `json:"tags,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Child    *testItem         `json:"child,omitempty"`
+	internal int
+	Ignored  string `json:"-"`
+}
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "/systems/{id}/packages", Path("/systems/:id/packages"))
+	assert.Equal(t, "/systems", Path("/systems"))
+}
+
+func TestSchemaOf(t *testing.T) {
+	doc := NewDocument("test", "1", "/")
+	schema := doc.SchemaOf(testItem{})
+	assert.Equal(t, "#/components/schemas/testItem", schema.Ref)
+
+	item := doc.Components.Schemas["testItem"]
+	assert.Equal(t, "object", item.Type)
+	assert.Equal(t, []string{"id", "name", "count", "checked"}, item.Required)
+	assert.Equal(t, 7, len(item.Properties))
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time", Nullable: true}, item.Properties["checked"])
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Type: "string"}}, item.Properties["tags"])
+	assert.Equal(t, &Schema{AllOf: []*Schema{schema}, Nullable: true}, item.Properties["child"])
+}
+
+func validate(t *testing.T, value string) error {
+	doc := NewDocument("test", "1", "/")
+	schema := doc.SchemaOf([]testItem{})
+	var decoded interface{}
+	assert.Nil(t, json.Unmarshal([]byte(value), &decoded))
+	return doc.Validate(schema, decoded)
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, validate(t, `[{"id": "1", "name": "a", "count": 1, "checked": null, "tags": ["x"],
+		"child": {"id": "2", "name": "b", "count": 2, "checked": "2019-01-01T00:00:00Z", "labels": {"k": "v"}}}]`))
+	assert.Nil(t, validate(t, `[]`))
+
+	cases := map[string]string{
+		`{}`:                                     "$: expected array, got map[string]interface {}",
+		`[{"id": "1", "name": "a", "count": 1}]`: "$[0]: missing property checked",
+		`[{"id": "1", "name": "a", "count": 1, "checked": null, "extra": 1}]`: "$[0]: unexpected property extra",
+		`[{"id": "1", "name": "a", "count": 1.5, "checked": null}]`:           "$[0].count: expected integer, got 1.5",
+		`[{"id": "1", "name": null, "count": 1, "checked": null}]`:            "$[0].name: null is not allowed",
+		`[{"id": "1", "name": "a", "count": 1, "checked": "yesterday"}]`:      "$[0].checked: invalid date-time yesterday",
+		`[{"id": "1", "name": "a", "count": 1, "checked": null, "labels": {"k": 1}}]`: "$[0].labels.k: expected " +
+			"string, got float64",
+	}
+	for value, expected := range cases {
+		err := validate(t, value)
+		if assert.NotNil(t, err, value) {
+			assert.Equal(t, expected, err.Error())
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package openapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// check decoded json value against schema, properties not described by schema are errors
+func (d *Document) Validate(schema *Schema, value interface{}) error {
+	return d.validate(schema, value, "$")
+}
+
+func (d *Document) validate(schema *Schema, value interface{}, path string) error {
+	if schema.Ref != "" {
+		referenced, ok := d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", path, schema.Ref)
+		}
+		return d.validate(referenced, value, path)
+	}
+	if value == nil {
+		if schema.Nullable || (schema.Type == "" && len(schema.AllOf) == 0) {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed", path)
+	}
+	for _, item := range schema.AllOf {
+		err := d.validate(item, value, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch schema.Type {
+	case "":
+		return nil
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %T", path, value)
+		}
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("%s: expected %s, got %T", path, schema.Type, value)
+		}
+		if schema.Type == "integer" && number != float64(int64(number)) {
+			return fmt.Errorf("%s: expected integer, got %v", path, number)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string, got %T", path, value)
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return fmt.Errorf("%s: invalid date-time %s", path, str)
+			}
+		}
+		if len(schema.Enum) > 0 && !hasOption(schema.Enum, str) {
+			return fmt.Errorf("%s: %s is not one of %v", path, str, schema.Enum)
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %T", path, value)
+		}
+		for i, item := range items {
+			err := d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+	case "object":
+		return d.validateObject(schema, value, path)
+	default:
+		return fmt.Errorf("%s: unsupported schema type %s", path, schema.Type)
+	}
+	return nil
+}
+
+func (d *Document) validateObject(schema *Schema, value interface{}, path string) error {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: expected object, got %T", path, value)
+	}
+	for _, name := range schema.Required {
+		if _, ok := object[name]; !ok {
+			return fmt.Errorf("%s: missing property %s", path, name)
+		}
+	}
+	// deterministic error for the same value
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property, ok := schema.Properties[name]
+		if !ok {
+			property = schema.AdditionalProperties
+		}
+		if property == nil {
+			return fmt.Errorf("%s: unexpected property %s", path, name)
+		}
+		err := d.validate(property, object[name], path+"."+name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
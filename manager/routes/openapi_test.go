@@ -0,0 +1,188 @@
+package routes
+
+import (
+	"app/base/core"
+	"app/base/database"
+	"app/base/structures"
+	"app/manager/controllers"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// routes which describe the api, not part of it
+var docRoutes = map[string]bool{
+	controllers.APIPrefix + "/openapi.json":        true,
+	controllers.APIPrefix + "/docs":                true,
+	controllers.SwaggerUIAssetsPath + "/*filepath": true,
+}
+
+func TestSpecCoversRoutes(t *testing.T) {
+	app := gin.New()
+	Init(app)
+	doc := controllers.APIDocument()
+
+	registered := map[string]bool{}
+	for _, route := range app.Routes() {
+		if !strings.HasPrefix(route.Path, controllers.APIPrefix) || docRoutes[route.Path] {
+			continue
+		}
+		path := strings.TrimPrefix(route.Path, controllers.APIPrefix)
+		registered[route.Method+" "+path] = true
+		assert.NotNil(t, doc.Operation(route.Method, path), "%s %s is missing in spec", route.Method, path)
+	}
+	for path, item := range doc.Paths {
+		for method := range item {
+			ginPath := strings.NewReplacer("{", ":", "}", "").Replace(path)
+			assert.True(t, registered[strings.ToUpper(method)+" "+ginPath], "%s %s is not registered", method, path)
+		}
+	}
+}
+
+func TestSwaggerUI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swagger-ui")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "swagger-ui.css"), []byte("body {}"), 0644))
+	assert.Nil(t, os.Setenv("ENABLE_SWAGGER_UI", "true"))
+	assert.Nil(t, os.Setenv("SWAGGER_UI_DIR", dir))
+	defer os.Unsetenv("ENABLE_SWAGGER_UI")
+	defer os.Unsetenv("SWAGGER_UI_DIR")
+	app := gin.New()
+	Init(app)
+
+	// page and assets are served locally
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", controllers.APIPrefix+"/docs", nil)
+	app.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `href="`+controllers.SwaggerUIAssetsPath+`/swagger-ui.css"`)
+	assert.NotContains(t, w.Body.String(), "https://")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", controllers.SwaggerUIAssetsPath+"/swagger-ui.css", nil)
+	app.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "body {}", w.Body.String())
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	// served without identity
+	app := gin.New()
+	Init(app)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", controllers.APIPrefix+"/openapi.json", nil)
+	app.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var doc map[string]interface{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.2", doc["openapi"])
+	assert.Contains(t, doc["paths"], "/systems/{id}")
+}
+
+func setupSpecData(t *testing.T) {
+	host := structures.HostDAO{InventoryID: "INV-1", Account: "0000001", DisplayName: "web", Request: "{}",
+		Checksum: "1", AdvisorySecCountCache: 1}
+	assert.Nil(t, database.Db.Create(&host).Error)
+	severity := "Important"
+	advisory := structures.AdvisoryMetadataDAO{Name: "RHSA-2019:0001", AdvisoryType: "security",
+		Severity: &severity, Synopsis: "bash update", Description: "fix", Issued: time.Now(), Updated: time.Now()}
+	assert.Nil(t, database.Db.Create(&advisory).Error)
+	assert.Nil(t, database.Db.Create(&structures.AdvisoryCveDAO{AdvisoryID: advisory.ID, Cve: "CVE-2019-1"}).Error)
+	ids, err := database.GetOrCreatePackages(database.Db, []string{"bash-4.2.46-35.el7.x86_64"})
+	assert.Nil(t, err)
+	assert.Nil(t, database.Db.Create(&structures.AdvisoryPackageDAO{AdvisoryID: advisory.ID,
+		PackageID: ids[0]}).Error)
+	assert.Nil(t, database.Db.Create(&structures.SystemAdvisoriesDAO{SystemID: host.ID, AdvisoryID: advisory.ID,
+		FirstReported: time.Now()}).Error)
+	assert.Nil(t, database.Db.Create(&structures.SystemPackageDAO{SystemID: host.ID, PackageID: ids[0]}).Error)
+	now := time.Now()
+	assert.Nil(t, database.Db.Model(&host).Update("last_evaluation", &now).Error)
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	core.SetupTestEnvironment()
+	setupSpecData(t)
+	doc := controllers.APIDocument()
+
+	cases := []struct {
+		method, route, url, body string
+		status                   int
+	}{
+		{"GET", "/systems", "/systems?sort=-rhsa_count&limit=1", "", http.StatusOK},
+		{"GET", "/systems", "/systems?sort=unknown", "", http.StatusBadRequest},
+		{"GET", "/systems/:id", "/systems/INV-1", "", http.StatusOK},
+		{"GET", "/systems/:id", "/systems/INV-2", "", http.StatusNotFound},
+		{"GET", "/systems/:id/advisories", "/systems/INV-1/advisories?search=bash", "", http.StatusOK},
+		{"GET", "/systems/:id/advisories", "/systems/INV-2/advisories", "", http.StatusNotFound},
+		{"GET", "/systems/:id/packages", "/systems/INV-1/packages", "", http.StatusOK},
+		{"GET", "/systems/:id/packages", "/systems/INV-1/packages?sort=version", "", http.StatusBadRequest},
+		{"PATCH", "/systems/:id", "/systems/INV-1", `{"opt_out": true}`, http.StatusOK},
+		{"PATCH", "/systems/:id", "/systems/INV-1", `{}`, http.StatusBadRequest},
+		{"GET", "/advisories", "/advisories", "", http.StatusOK},
+		{"GET", "/advisories/:id", "/advisories/RHSA-2019:0001", "", http.StatusOK},
+		{"GET", "/advisories/:id", "/advisories/RHSA-2019:0002", "", http.StatusNotFound},
+		{"GET", "/advisories/:id/systems", "/advisories/RHSA-2019:0001/systems?filter[stale]=false", "",
+			http.StatusOK},
+		{"GET", "/advisories/:id/systems", "/advisories/RHSA-2019:0002/systems", "", http.StatusNotFound},
+		{"GET", "/packages", "/packages", "", http.StatusOK},
+		{"GET", "/packages/:name/systems", "/packages/bash/systems?filter[evr]=geq:4.2.46-35.el7", "",
+			http.StatusOK},
+		{"GET", "/packages/:name/systems", "/packages/bash/systems?filter[evr]=4.2", "", http.StatusBadRequest},
+		{"GET", "/packages/:name/systems", "/packages/kernel/systems", "", http.StatusNotFound},
+		{"DELETE", "/systems/:id", "/systems/INV-1", "", http.StatusNoContent},
+	}
+	for _, c := range cases {
+		name := fmt.Sprintf("%s %s %d", c.method, c.url, c.status)
+		w := serveBody(c.method, controllers.APIPrefix+c.url, c.body)
+		assert.Equal(t, c.status, w.Code, name)
+
+		operation := doc.Operation(c.method, c.route)
+		if !assert.NotNil(t, operation, name) {
+			continue
+		}
+		response := operation.Responses[fmt.Sprint(c.status)]
+		if !assert.NotNil(t, response, "%s: status is not documented", name) {
+			continue
+		}
+		if response.Content == nil {
+			assert.Equal(t, 0, w.Body.Len(), name)
+			continue
+		}
+		var body interface{}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body), name)
+		assert.Nil(t, doc.Validate(response.Content["application/json"].Schema, body), name)
+	}
+}
+
+// search parameter describes expressions searched by each list
+func TestSearchDescriptions(t *testing.T) {
+	for path, search := range map[string]string{
+		"/systems":                "case insensitive substring of inventory id or display name",
+		"/advisories/:id/systems": "case insensitive substring of inventory id or display name",
+		"/advisories":             "case insensitive substring of advisory name or synopsis",
+		"/packages":               "case insensitive substring of package name",
+		"/packages/:name/systems": "case insensitive substring of inventory id or display name",
+		"/systems/:id/packages":   "case insensitive substring of package name",
+		"/systems/:id/advisories": "case insensitive substring of advisory name or synopsis",
+	} {
+		operation := controllers.APIDocument().Operation("GET", path)
+		description := ""
+		for _, param := range operation.Parameters {
+			if param.Name == "search" {
+				description = param.Description
+			}
+		}
+		assert.Equal(t, search, description, path)
+	}
+}
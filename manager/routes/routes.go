@@ -1,7 +1,9 @@
 package routes
 
 import (
+	"app/base/utils"
 	"app/manager/controllers"
+	"app/manager/middlewares"
 	"github.com/gin-gonic/gin"
 )
 
@@ -10,8 +12,33 @@ func Init(app *gin.Engine) {
 	// public routes
 	app.GET("/health", controllers.HealthHandler)
 	app.GET("/db_health", controllers.HealthDBHandler)
-	app.GET("/samples", controllers.ListHandler)
-	app.GET("/hosts/:id", controllers.GetHostHandler)
-	app.GET("/create", controllers.CreateHandler)
-	app.GET("/delete", controllers.DeleteHandler)
+	app.GET(controllers.APIPrefix+"/openapi.json", controllers.OpenAPIHandler)
+	if utils.Getenv("ENABLE_SWAGGER_UI", "false") == "true" {
+		app.GET(controllers.APIPrefix+"/docs", controllers.SwaggerUIHandler)
+		// downloaded by image build, see SWAGGER_UI_VERSION in Dockerfile
+		app.Static(controllers.SwaggerUIAssetsPath, utils.Getenv("SWAGGER_UI_DIR", "/go/src/app/swagger-ui"))
+	}
+
+	// errors in the same envelope as api ones
+	app.HandleMethodNotAllowed = true
+	app.NoRoute(controllers.NotFoundHandler)
+	app.NoMethod(controllers.MethodNotAllowedHandler)
+
+	// operations have to be described in controllers.apiOperations
+	// RBAC resource is the first path segment, e.g. patch:systems:read
+	api := app.Group(controllers.APIPrefix, middlewares.Authenticator())
+	systems := api.Group("/systems", middlewares.RBAC("systems"))
+	systems.GET("", controllers.SystemsListHandler)
+	systems.GET("/:id", controllers.SystemDetailHandler)
+	systems.DELETE("/:id", controllers.SystemDeleteHandler)
+	systems.PATCH("/:id", controllers.SystemUpdateHandler)
+	systems.GET("/:id/advisories", controllers.SystemAdvisoriesHandler)
+	systems.GET("/:id/packages", controllers.SystemPackagesHandler)
+	advisories := api.Group("/advisories", middlewares.RBAC("advisories"))
+	advisories.GET("", controllers.AdvisoriesListHandler)
+	advisories.GET("/:id", controllers.AdvisoryDetailHandler)
+	advisories.GET("/:id/systems", controllers.AdvisorySystemsHandler)
+	packages := api.Group("/packages", middlewares.RBAC("packages"))
+	packages.GET("", controllers.PackagesListHandler)
+	packages.GET("/:name/systems", controllers.PackageSystemsHandler)
 }
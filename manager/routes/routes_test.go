@@ -0,0 +1,98 @@
+package routes
+
+import (
+	"app/base/core"
+	"app/manager/middlewares"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// {"identity": {"account_number": "0000001", "type": "User"}}
+const testIdentity = "eyJpZGVudGl0eSI6IHsiYWNjb3VudF9udW1iZXIiOiAiMDAwMDAwMSIsICJ0eXBlIjogIlVzZXIifX0="
+
+func TestMain(m *testing.M) {
+	// all identities have full access
+	file, err := ioutil.TempFile("", "rbac-*.json")
+	if err != nil {
+		panic(err)
+	}
+	_, err = file.WriteString(`{"*": ["patch:*:*"]}`)
+	if err != nil {
+		panic(err)
+	}
+	file.Close()
+	os.Setenv("RBAC_SOURCE", "file")
+	os.Setenv("RBAC_FILE", file.Name())
+	middlewares.ConfigureRBAC()
+	code := m.Run()
+	os.Remove(file.Name())
+	os.Exit(code)
+}
+
+func serve(method, path string) *httptest.ResponseRecorder {
+	return serveBody(method, path, "")
+}
+
+func serveBody(method, path, body string) *httptest.ResponseRecorder {
+	app := gin.New()
+	Init(app)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("x-rh-identity", testIdentity)
+	app.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIRoutes(t *testing.T) {
+	core.SetupTestEnvironment()
+
+	assert.Equal(t, http.StatusOK, serve("GET", "/api/patch/v1/systems").Code)
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/api/patch/v1/systems/INV-1").Code)
+	assert.Equal(t, http.StatusNotFound, serve("DELETE", "/api/patch/v1/systems/INV-1").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("PATCH", "/api/patch/v1/systems/INV-1").Code)
+	assert.Equal(t, http.StatusOK, serve("GET", "/api/patch/v1/advisories").Code)
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/api/patch/v1/advisories/RHSA-2019:0001").Code)
+}
+
+func TestAPIUnauthenticated(t *testing.T) {
+	core.SetupTestEnvironment()
+	app := gin.New()
+	Init(app)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/patch/v1/systems", nil)
+	app.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// health checks don't need identity
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/health", nil)
+	app.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRemovedRoutes(t *testing.T) {
+	core.SetupTestEnvironment()
+
+	for _, path := range []string{"/samples", "/hosts/1", "/create?id=1", "/delete?id=1"} {
+		w := serve("GET", path)
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+		assert.Equal(t, `{"error":{"status":404,"title":"Not Found","detail":"resource not found"}}`,
+			w.Body.String())
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	core.SetupTestEnvironment()
+
+	w := serve("POST", "/api/patch/v1/systems")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, `{"error":{"status":405,"title":"Method Not Allowed","detail":"method not allowed"}}`,
+		w.Body.String())
+}
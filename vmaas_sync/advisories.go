@@ -0,0 +1,164 @@
+package vmaas_sync
+
+import (
+	"app/base/database"
+	"app/base/structures"
+	"app/base/utils"
+	"github.com/jinzhu/gorm"
+	"sort"
+	"time"
+)
+
+// insert new advisory or update stored one, both PostgreSQL and SQLite support this syntax
+const upsertAdvisorySQL = `INSERT INTO advisory_metadata
+	(name, advisory_type, severity, synopsis, description, solution, url, issued, updated)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (name) DO UPDATE SET
+	advisory_type = excluded.advisory_type, severity = excluded.severity, synopsis = excluded.synopsis,
+	description = excluded.description, solution = excluded.solution, url = excluded.url,
+	issued = excluded.issued, updated = excluded.updated`
+
+// sync state of advisories, stored after all pages are committed
+const (
+	advisoriesSync     = "advisories"
+	upsertSyncStateSQL = `INSERT INTO sync_state (name, last_sync) VALUES (?, ?)
+	ON CONFLICT (name) DO UPDATE SET last_sync = excluded.last_sync`
+)
+
+// start time of the last complete sync, nil when there is none
+// used as modified_since of the next sync, advisories modified during the last sync are re-imported harmlessly
+func lastSync() (*time.Time, error) {
+	var state structures.SyncStateDAO
+	err := database.Db.Where("name = ?", advisoriesSync).First(&state).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state.LastSync, nil
+}
+
+// import errata modified since the last complete sync, return number of stored advisories
+// pages are committed separately, so the sync time moves forward only when all of them are stored
+func syncAdvisories(source errataSource) (int, error) {
+	syncStart := time.Now()
+	modifiedSince, err := lastSync()
+	if err != nil {
+		return 0, err
+	}
+
+	stored := 0
+	err = source.forEachPage(modifiedSince, func(errata map[string]Erratum) error {
+		err := storeAdvisories(errata)
+		if err != nil {
+			return err
+		}
+		stored += len(errata)
+		utils.Log("stored", stored).Debug("advisories page stored")
+		return nil
+	})
+	if err != nil {
+		return stored, err
+	}
+	return stored, database.Db.Exec(upsertSyncStateSQL, advisoriesSync, syncStart).Error
+}
+
+// store advisories in single transaction, packages and CVEs of stored advisories are replaced
+func storeAdvisories(errata map[string]Erratum) error {
+	names := make([]string, 0, len(errata))
+	for name := range errata {
+		names = append(names, name)
+	}
+	// same order of locked rows in concurrent transactions
+	sort.Strings(names)
+
+	return database.Transaction(func(tx *gorm.DB) error {
+		for _, name := range names {
+			err := storeAdvisory(tx, name, errata[name])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func storeAdvisory(tx *gorm.DB, name string, erratum Erratum) error {
+	err := tx.Exec(upsertAdvisorySQL, name, erratum.Type, erratum.Severity, erratum.Synopsis,
+		erratum.Description, erratum.Solution, erratum.URL, erratum.Issued, erratum.Updated).Error
+	if err != nil {
+		return err
+	}
+
+	var advisory structures.AdvisoryMetadataDAO
+	err = tx.Select("id").Where("name = ?", name).First(&advisory).Error
+	if err != nil {
+		return err
+	}
+
+	packageIDs, err := database.GetOrCreatePackages(tx, erratum.PackageList)
+	if err != nil {
+		return err
+	}
+	err = tx.Where("advisory_id = ?", advisory.ID).Delete(&structures.AdvisoryPackageDAO{}).Error
+	if err != nil {
+		return err
+	}
+	for _, id := range unique(packageIDs) {
+		err = tx.Create(&structures.AdvisoryPackageDAO{AdvisoryID: advisory.ID, PackageID: id}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	err = replaceItems(tx, advisory.ID, &structures.AdvisoryCveDAO{}, erratum.CveList,
+		func(cve string) interface{} { return &structures.AdvisoryCveDAO{AdvisoryID: advisory.ID, Cve: cve} })
+	if err != nil {
+		return err
+	}
+	err = replaceItems(tx, advisory.ID, &structures.AdvisoryReferenceDAO{}, erratum.ReferenceList,
+		func(reference string) interface{} {
+			return &structures.AdvisoryReferenceDAO{AdvisoryID: advisory.ID, Reference: reference}
+		})
+	if err != nil {
+		return err
+	}
+	return replaceItems(tx, advisory.ID, &structures.AdvisoryReleaseVersionDAO{}, erratum.ReleaseVersions,
+		func(version string) interface{} {
+			return &structures.AdvisoryReleaseVersionDAO{AdvisoryID: advisory.ID, ReleaseVersion: version}
+		})
+}
+
+// replace advisory rows of model table by rows created from unique values
+func replaceItems(tx *gorm.DB, advisoryID int, model interface{}, values []string,
+	create func(value string) interface{}) error {
+	err := tx.Where("advisory_id = ?", advisoryID).Delete(model).Error
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, value := range values {
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		err = tx.Create(create(value)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unique(ids []int) []int {
+	seen := map[int]bool{}
+	res := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			res = append(res, id)
+		}
+	}
+	return res
+}
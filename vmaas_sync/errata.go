@@ -0,0 +1,127 @@
+package vmaas_sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const errataPath = "/api/v1/errata"
+
+// VMaaS errata request, all errata are matched by ".*"
+type ErrataRequest struct {
+	ErrataList    []string   `json:"errata_list"`
+	ModifiedSince *time.Time `json:"modified_since,omitempty"`
+	Page          int        `json:"page,omitempty"`
+	PageSize      int        `json:"page_size,omitempty"`
+}
+
+// VMaaS errata response, JSON dump has the same format with all errata in single page
+type ErrataResponse struct {
+	ErrataList map[string]Erratum `json:"errata_list"`
+	Page       int                `json:"page"`
+	PageSize   int                `json:"page_size"`
+	Pages      int                `json:"pages"`
+}
+
+type Erratum struct {
+	Type        string    `json:"type"`
+	Severity    *string   `json:"severity"`
+	Synopsis    string    `json:"synopsis"`
+	Description string    `json:"description"`
+	Solution    string    `json:"solution"`
+	URL         string    `json:"url"`
+	Issued      time.Time `json:"issued"`
+	Updated     time.Time `json:"updated"`
+	CveList     []string  `json:"cve_list"`
+	PackageList []string  `json:"package_list"`
+	// bugzilla ids and other references
+	ReferenceList   []string `json:"reference_list"`
+	ReleaseVersions []string `json:"release_versions"`
+}
+
+// source of errata, either VMaaS service or JSON dump
+type errataSource interface {
+	// call fn with errata modified since given time (all when nil), page by page
+	forEachPage(modifiedSince *time.Time, fn func(errata map[string]Erratum) error) error
+}
+
+type vmaasSource struct {
+	client   *http.Client
+	address  string
+	pageSize int
+}
+
+func newVmaasSource(address string, pageSize int, timeout time.Duration) *vmaasSource {
+	return &vmaasSource{client: &http.Client{Timeout: timeout}, address: strings.TrimSuffix(address, "/"),
+		pageSize: pageSize}
+}
+
+func (s *vmaasSource) forEachPage(modifiedSince *time.Time, fn func(errata map[string]Erratum) error) error {
+	for page := 1; ; page++ {
+		resp, err := s.fetchPage(ErrataRequest{ErrataList: []string{".*"}, ModifiedSince: modifiedSince,
+			Page: page, PageSize: s.pageSize})
+		if err != nil {
+			return err
+		}
+		err = fn(resp.ErrataList)
+		if err != nil {
+			return err
+		}
+		if page >= resp.Pages {
+			return nil
+		}
+	}
+}
+
+func (s *vmaasSource) fetchPage(request ErrataRequest) (*ErrataResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Post(s.address+errataPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch errata page %d, status %d", request.Page, resp.StatusCode)
+	}
+
+	var res ErrataResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// JSON dump of errata, modified_since is applied locally
+type dumpSource struct {
+	path string
+}
+
+func (s *dumpSource) forEachPage(modifiedSince *time.Time, fn func(errata map[string]Erratum) error) error {
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var dump ErrataResponse
+	err = json.Unmarshal(content, &dump)
+	if err != nil {
+		return err
+	}
+
+	errata := map[string]Erratum{}
+	for name, erratum := range dump.ErrataList {
+		if modifiedSince == nil || !erratum.Updated.Before(*modifiedSince) {
+			errata[name] = erratum
+		}
+	}
+	return fn(errata)
+}
@@ -0,0 +1,41 @@
+package vmaas_sync
+
+import (
+	"app/base/utils"
+	"strconv"
+	"time"
+)
+
+// admin command, imports advisories from VMaaS service (VMAAS_ADDRESS) or JSON dump (VMAAS_DUMP_FILE)
+// run periodically, each run imports only advisories modified since the previous complete one
+func RunVmaasSync() {
+	source := configure()
+
+	start := time.Now()
+	stored, err := syncAdvisories(source)
+	if err != nil {
+		utils.Log("err", err.Error(), "stored", stored).Error("advisories sync failed")
+		panic(err)
+	}
+	utils.Log("stored", stored, "duration", time.Since(start).Seconds()).Info("advisories synced")
+}
+
+func configure() errataSource {
+	dumpFile := utils.Getenv("VMAAS_DUMP_FILE", "")
+	if dumpFile != "" {
+		utils.Log("path", dumpFile).Info("syncing advisories from dump")
+		return &dumpSource{path: dumpFile}
+	}
+
+	address := utils.GetenvOrFail("VMAAS_ADDRESS")
+	pageSize, err := strconv.Atoi(utils.Getenv("VMAAS_PAGE_SIZE", "500"))
+	if err != nil {
+		panic(err)
+	}
+	timeout, err := strconv.Atoi(utils.Getenv("VMAAS_TIMEOUT", "60"))
+	if err != nil {
+		panic(err)
+	}
+	utils.Log("address", address).Info("syncing advisories from VMaaS")
+	return newVmaasSource(address, pageSize, time.Duration(timeout)*time.Second)
+}
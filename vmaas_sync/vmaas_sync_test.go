@@ -0,0 +1,178 @@
+package vmaas_sync
+
+import (
+	"app/base/core"
+	"app/base/database"
+	"app/base/structures"
+	"encoding/json"
+	"github.com/bmizerany/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+var (
+	issued    = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	important = "Important"
+)
+
+func testErrata() map[string]Erratum {
+	return map[string]Erratum{
+		"RHSA-2019:0001": {Type: "security", Severity: &important, Synopsis: "Important: bash security update",
+			Description: "bash fix", Solution: "update", Issued: issued, Updated: issued,
+			CveList:       []string{"CVE-2019-0001", "CVE-2019-0002"},
+			PackageList:   []string{"bash-4.2.46-34.el7.x86_64", "bash-4.2.46-34.el7.i686"},
+			ReferenceList: []string{"1700001", "1700001"}, ReleaseVersions: []string{"7.6", "7.7"}},
+		"RHBA-2019:0002": {Type: "bugfix", Synopsis: "kernel bug fix", Description: "kernel fix",
+			Issued: issued, Updated: issued.Add(time.Hour),
+			PackageList: []string{"kernel-3.10.0-1062.el7.x86_64"}},
+		"RHEA-2019:0003": {Type: "enhancement", Synopsis: "new feature", Description: "feature",
+			Issued: issued, Updated: issued.Add(2 * time.Hour)},
+	}
+}
+
+// VMaaS stand-in, serves errata modified since requested time, one erratum per page
+func testVmaasServer(t *testing.T, errata map[string]Erratum, requests *[]ErrataRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, errataPath, r.URL.Path)
+		var request ErrataRequest
+		assert.Equal(t, nil, json.NewDecoder(r.Body).Decode(&request))
+		*requests = append(*requests, request)
+
+		var names []string
+		for name, erratum := range errata {
+			if request.ModifiedSince == nil || !erratum.Updated.Before(*request.ModifiedSince) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		resp := ErrataResponse{ErrataList: map[string]Erratum{}, Page: request.Page, PageSize: 1, Pages: len(names)}
+		if request.Page <= len(names) {
+			name := names[request.Page-1]
+			resp.ErrataList[name] = errata[name]
+		}
+		assert.Equal(t, nil, json.NewEncoder(w).Encode(resp))
+	}))
+}
+
+func advisoryCounts(t *testing.T) (int, int, int) {
+	var advisories, packages, cves int
+	assert.Equal(t, nil, database.Db.Model(&structures.AdvisoryMetadataDAO{}).Count(&advisories).Error)
+	assert.Equal(t, nil, database.Db.Model(&structures.AdvisoryPackageDAO{}).Count(&packages).Error)
+	assert.Equal(t, nil, database.Db.Model(&structures.AdvisoryCveDAO{}).Count(&cves).Error)
+	return advisories, packages, cves
+}
+
+func TestSyncFromVmaas(t *testing.T) {
+	core.SetupTestEnvironment()
+	errata := testErrata()
+	var requests []ErrataRequest
+	server := testVmaasServer(t, errata, &requests)
+	defer server.Close()
+	source := newVmaasSource(server.URL+"/", 1, time.Second)
+
+	syncStart := time.Now()
+	stored, err := syncAdvisories(source)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, stored)
+	assert.Equal(t, 3, len(requests))
+	assert.Equal(t, (*time.Time)(nil), requests[0].ModifiedSince)
+	advisories, packages, cves := advisoryCounts(t)
+	assert.Equal(t, []int{3, 3, 2}, []int{advisories, packages, cves})
+
+	var advisory structures.AdvisoryMetadataDAO
+	assert.Equal(t, nil, database.Db.Where("name = ?", "RHSA-2019:0001").First(&advisory).Error)
+	assert.Equal(t, "security", advisory.AdvisoryType)
+	assert.Equal(t, "Important", *advisory.Severity)
+	assert.Equal(t, true, advisory.Issued.Equal(issued))
+	var references, versions []string
+	assert.Equal(t, nil, database.Db.Model(&structures.AdvisoryReferenceDAO{}).Pluck("reference", &references).Error)
+	assert.Equal(t, []string{"1700001"}, references)
+	assert.Equal(t, nil, database.Db.Model(&structures.AdvisoryReleaseVersionDAO{}).Order("release_version").
+		Pluck("release_version", &versions).Error)
+	assert.Equal(t, []string{"7.6", "7.7"}, versions)
+
+	// incremental, only advisories modified since the previous sync started are fetched
+	erratum := errata["RHSA-2019:0001"]
+	erratum.Updated = time.Now()
+	erratum.PackageList = []string{"bash-4.2.46-35.el7.x86_64"}
+	erratum.CveList = []string{"CVE-2019-0001"}
+	errata["RHSA-2019:0001"] = erratum
+	requests = nil
+
+	stored, err = syncAdvisories(source)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, stored)
+	assert.Equal(t, false, requests[0].ModifiedSince.Before(syncStart))
+	assert.Equal(t, true, requests[0].ModifiedSince.Before(erratum.Updated))
+	advisories, packages, cves = advisoryCounts(t)
+	assert.Equal(t, []int{3, 2, 1}, []int{advisories, packages, cves})
+}
+
+func TestSyncFromVmaasFailed(t *testing.T) {
+	core.SetupTestEnvironment()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := syncAdvisories(newVmaasSource(server.URL, 10, time.Second))
+	assert.Equal(t, "unable to fetch errata page 1, status 503", err.Error())
+}
+
+func TestSyncFromVmaasPartial(t *testing.T) {
+	core.SetupTestEnvironment()
+	var requests []ErrataRequest
+	server := testVmaasServer(t, testErrata(), &requests)
+	defer server.Close()
+	// second page of the first sync fails
+	calls := 0
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer failing.Close()
+	source := newVmaasSource(failing.URL, 1, time.Second)
+
+	stored, err := syncAdvisories(source)
+	assert.Equal(t, "unable to fetch errata page 2, status 503", err.Error())
+	assert.Equal(t, 1, stored)
+
+	// committed page doesn't move the sync time, everything is fetched again
+	stored, err = syncAdvisories(source)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, stored)
+	assert.Equal(t, (*time.Time)(nil), requests[1].ModifiedSince)
+}
+
+func TestSyncFromDump(t *testing.T) {
+	core.SetupTestEnvironment()
+	dump, err := json.Marshal(ErrataResponse{ErrataList: testErrata(), Page: 1, Pages: 1})
+	assert.Equal(t, nil, err)
+	file, err := ioutil.TempFile("", "errata-*.json")
+	assert.Equal(t, nil, err)
+	defer os.Remove(file.Name())
+	_, err = file.Write(dump)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, file.Close())
+	source := &dumpSource{path: file.Name()}
+
+	stored, err := syncAdvisories(source)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, stored)
+
+	// nothing modified since the previous import
+	stored, err = syncAdvisories(source)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, stored)
+	advisories, packages, cves := advisoryCounts(t)
+	assert.Equal(t, []int{3, 3, 2}, []int{advisories, packages, cves})
+}